@@ -0,0 +1,440 @@
+// Package builder generates the SQL of the visual query builder from its options.
+//
+// It follows getSQLFromQueryOptions of the query editor, so that queries carrying builder options but a stale
+// rawSql, like alert rules or dashboards provisioned through the API, run the query the editor would show.
+// Both implementations are tested against the cases of testdata/sql.golden.json.
+package builder
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Mode - mode of the query builder
+type Mode string
+
+const (
+	ModeList      Mode = "list"
+	ModeAggregate Mode = "aggregate"
+	ModeTrend     Mode = "trend"
+)
+
+// FilterOperator - operator of a filter, as chosen in the editor
+type FilterOperator string
+
+const (
+	OperatorIsNull                  FilterOperator = "IS NULL"
+	OperatorIsNotNull               FilterOperator = "IS NOT NULL"
+	OperatorEquals                  FilterOperator = "="
+	OperatorNotEquals               FilterOperator = "!="
+	OperatorLessThan                FilterOperator = "<"
+	OperatorLessThanOrEqual         FilterOperator = "<="
+	OperatorGreaterThan             FilterOperator = ">"
+	OperatorGreaterThanOrEqual      FilterOperator = ">="
+	OperatorLike                    FilterOperator = "LIKE"
+	OperatorILike                   FilterOperator = "ILIKE"
+	OperatorNotLike                 FilterOperator = "NOT LIKE"
+	OperatorNotILike                FilterOperator = "NOT ILIKE"
+	OperatorMatch                   FilterOperator = "~"
+	OperatorNotMatch                FilterOperator = "!~"
+	OperatorIn                      FilterOperator = "IN"
+	OperatorNotIn                   FilterOperator = "NOT IN"
+	OperatorContainedBy             FilterOperator = "<<"
+	OperatorContainedByOrEqual      FilterOperator = "<<="
+	OperatorWithInGrafanaTimeRange  FilterOperator = "WITH IN DASHBOARD TIME RANGE"
+	OperatorOutsideGrafanaTimeRange FilterOperator = "OUTSIDE DASHBOARD TIME RANGE"
+)
+
+// AlignToMode - alignment of the SAMPLE BY buckets
+type AlignToMode string
+
+const (
+	AlignToFirstObservation AlignToMode = "FIRST OBSERVATION"
+	AlignToCalendar         AlignToMode = "CALENDAR"
+	AlignToCalendarTimeZone AlignToMode = "CALENDAR TIME ZONE"
+	AlignToCalendarOffset   AlignToMode = "CALENDAR WITH OFFSET"
+)
+
+const (
+	grafanaStartTime = "GRAFANA_START_TIME"
+	grafanaEndTime   = "GRAFANA_END_TIME"
+)
+
+// Options - builderOptions of a query
+type Options struct {
+	Mode                 Mode          `json:"mode"`
+	Table                string        `json:"table"`
+	Fields               []string      `json:"fields"`
+	Metrics              []MetricField `json:"metrics"`
+	GroupBy              []string      `json:"groupBy"`
+	Filters              []Filter      `json:"filters"`
+	PartitionBy          []string      `json:"partitionBy"`
+	OrderBy              []OrderBy     `json:"orderBy"`
+	Limit                interface{}   `json:"limit"`
+	TimeField            string        `json:"timeField"`
+	SampleByAlignTo      AlignToMode   `json:"sampleByAlignTo"`
+	SampleByAlignToValue string        `json:"sampleByAlignToValue"`
+	SampleByFill         []string      `json:"sampleByFill"`
+}
+
+// MetricField - aggregation of a field, as aggregation(field) alias
+type MetricField struct {
+	Field       string `json:"field"`
+	Aggregation string `json:"aggregation"`
+	Alias       string `json:"alias"`
+}
+
+// OrderBy - ordering of the results by a field or expression
+type OrderBy struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+}
+
+// Filter - condition of the WHERE clause. The value is a boolean, a number, a string or a list of strings
+// depending on the type of the column and the operator, the condition joins it to the previous filter.
+type Filter struct {
+	Key       string         `json:"key"`
+	Type      string         `json:"type"`
+	Operator  FilterOperator `json:"operator"`
+	Condition string         `json:"condition"`
+	Value     interface{}    `json:"value"`
+}
+
+// Variable - template variable of the dashboard, with its current value, either a string or a list of strings
+type Variable struct {
+	Name    string `json:"name"`
+	Multi   bool   `json:"multi"`
+	Current struct {
+		Value interface{} `json:"value"`
+	} `json:"current"`
+}
+
+// singleValued tells whether the variable has one current value
+func (v Variable) singleValued() bool {
+	switch value := v.Current.Value.(type) {
+	case string:
+		return true
+	case []interface{}:
+		return len(value) == 1
+	}
+	return false
+}
+
+// SQL returns the query of the builder options. Template variables are left in the query, unquoted when they are
+// the value of an IN filter or have a single value, as the editor does with the variables of the dashboard.
+func SQL(options Options, variables []Variable) string {
+	fields := escapeFields(options.Fields)
+	var query strings.Builder
+	switch options.Mode {
+	case ModeAggregate:
+		query.WriteString(aggregationQuery(options.Table, fields, options.Metrics, options.GroupBy))
+		if filters, _ := whereFilters(options.Filters, variables); filters != "" {
+			query.WriteString(" WHERE" + filters)
+		}
+		if len(options.GroupBy) > 0 {
+			query.WriteString(" GROUP BY " + strings.Join(options.GroupBy, ", "))
+		}
+	case ModeTrend:
+		query.WriteString(sampleByQuery(options.Table, options.Metrics, options.GroupBy, options.TimeField))
+		filters, hasTimeFilter := whereFilters(options.Filters, variables)
+		if options.TimeField != "" || filters != "" {
+			query.WriteString(" WHERE")
+			if options.TimeField != "" && !hasTimeFilter {
+				query.WriteString(fmt.Sprintf(" $__timeFilter(%s)", options.TimeField))
+				if filters != "" {
+					query.WriteString(" AND")
+				}
+			}
+			if filters != "" {
+				query.WriteString(" " + filters)
+			}
+		}
+		query.WriteString(sampleBy(options.SampleByAlignTo, options.SampleByAlignToValue, options.SampleByFill))
+	default:
+		if len(fields) == 0 {
+			fields = []string{""}
+		}
+		query.WriteString(fmt.Sprintf("SELECT %s FROM %s", strings.Join(fields, ", "), escaped(options.Table)))
+		if filters, _ := whereFilters(options.Filters, variables); filters != "" {
+			query.WriteString(" WHERE" + filters)
+		}
+		if options.TimeField != "" && len(options.PartitionBy) > 0 {
+			query.WriteString(fmt.Sprintf(" LATEST ON %s PARTITION BY %s", options.TimeField, strings.Join(options.PartitionBy, ", ")))
+		}
+	}
+
+	query.WriteString(orderBy(options.OrderBy))
+	if truthy(options.Limit) {
+		query.WriteString(" LIMIT " + text(options.Limit))
+	}
+	return query.String()
+}
+
+var unquotedField = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z_0-9]*$`)
+
+// escapeFields quotes the fields that are not plain identifiers
+func escapeFields(fields []string) []string {
+	escapedFields := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field != "*" && field != "" && !unquotedField.MatchString(field) {
+			field = `"` + field + `"`
+		}
+		escapedFields = append(escapedFields, field)
+	}
+	return escapedFields
+}
+
+func escaped(table string) string {
+	if table == "" {
+		return ""
+	}
+	return `"` + table + `"`
+}
+
+func metricsList(metrics []MetricField) string {
+	list := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		metric := fmt.Sprintf("%s(%s)", m.Aggregation, m.Field)
+		if m.Alias != "" {
+			metric += " " + strings.ReplaceAll(m.Alias, " ", "_")
+		}
+		list = append(list, metric)
+	}
+	return strings.Join(list, ", ")
+}
+
+func aggregationQuery(table string, fields []string, metrics []MetricField, groupBy []string) string {
+	selected := strings.Join(fields, ", ")
+	metricsQuery := metricsList(metrics)
+	var groups []string
+	for _, group := range groupBy {
+		if !contains(fields, group) {
+			groups = append(groups, group)
+		}
+	}
+	groupByQuery := strings.Join(groups, ", ")
+
+	query := "SELECT " + selected
+	if selected != "" && (groupByQuery != "" || metricsQuery != "") {
+		query += ", "
+	}
+	query += groupByQuery
+	if metricsQuery != "" && groupByQuery != "" {
+		query += ", "
+	}
+	return query + metricsQuery + " FROM " + escaped(table)
+}
+
+func sampleByQuery(table string, metrics []MetricField, groupBy []string, timeField string) string {
+	selected := timeField + " as time"
+	if metricsQuery := metricsList(metrics); metricsQuery != "" {
+		group := ""
+		if len(groupBy) > 0 {
+			group = strings.Join(groupBy, ", ") + ","
+		}
+		selected = fmt.Sprintf("%s, %s %s", selected, group, metricsQuery)
+	} else if len(groupBy) > 0 {
+		selected += ", " + strings.Join(groupBy, ", ")
+	}
+	return "SELECT " + selected + " FROM " + escaped(table)
+}
+
+// whereFilters returns the conditions of the filters, and whether one of them is on the dashboard time range
+func whereFilters(filters []Filter, variables []Variable) (string, bool) {
+	var combined string
+	hasTimeFilter := false
+	for _, f := range filters {
+		field := f.Key
+		operator := string(f.Operator)
+		not := false
+		switch f.Operator {
+		case OperatorNotLike:
+			operator = string(OperatorLike)
+			not = true
+		case OperatorOutsideGrafanaTimeRange:
+			operator = ""
+			not = true
+			field = fmt.Sprintf(" $__timeFilter(%s)", f.Key)
+			hasTimeFilter = true
+		case OperatorWithInGrafanaTimeRange:
+			operator = ""
+			field = fmt.Sprintf(" $__timeFilter(%s)", f.Key)
+			hasTimeFilter = true
+		}
+		filter := " " + field
+		if operator != "" {
+			filter += " " + operator
+		}
+
+		switch {
+		case f.Operator == OperatorIsNull || f.Operator == OperatorIsNotNull:
+		case f.Operator == OperatorIn || f.Operator == OperatorNotIn:
+			values, _ := f.Value.([]interface{})
+			list := make([]string, 0, len(values))
+			for _, v := range values {
+				if isNumberType(f.Type) {
+					list = append(list, strings.TrimSpace(text(v)))
+				} else {
+					list = append(list, strings.TrimSpace(stringValue(text(v), variables, true)))
+				}
+			}
+			filter += fmt.Sprintf(" (%s )", strings.Join(list, ", "))
+		case isBooleanType(f.Type):
+			filter += " " + text(f.Value)
+		case isNumberType(f.Type):
+			if truthy(f.Value) {
+				filter += " " + text(f.Value)
+			} else {
+				filter += " 0"
+			}
+		case isDateType(f.Type):
+			if f.Operator == OperatorWithInGrafanaTimeRange || f.Operator == OperatorOutsideGrafanaTimeRange {
+				break
+			}
+			switch value := text(f.Value); value {
+			case grafanaStartTime:
+				filter += " $__fromTime"
+			case grafanaEndTime:
+				filter += " $__toTime"
+			case "":
+				filter += " TODAY"
+			default:
+				filter += " " + value
+			}
+		default:
+			value := f.Value
+			if values, ok := value.([]interface{}); ok && len(values) > 0 {
+				value = values[0]
+			}
+			filter += stringValue(text(value), variables, false)
+		}
+
+		if not {
+			filter = fmt.Sprintf(" NOT (%s )", filter)
+		}
+		if combined == "" {
+			combined = filter
+		} else {
+			combined = fmt.Sprintf("%s %s%s", combined, f.Condition, filter)
+		}
+	}
+	return removeQuotesForMultiVariables(combined, variables), hasTimeFilter
+}
+
+// stringValue quotes the value, but template variables in lists of values which expand to a list themselves,
+// and template variables with a single value
+func stringValue(value string, variables []Variable, multiple bool) string {
+	if strings.HasPrefix(value, "$") {
+		name := strings.NewReplacer("{", "", "}", "").Replace(value[1:])
+		if multiple || slices.ContainsFunc(variables, func(v Variable) bool { return v.Name == name && v.singleValued() }) {
+			return " " + value
+		}
+	}
+	return fmt.Sprintf(" '%s'", value)
+}
+
+// removeQuotesForMultiVariables drops the quotes before the closing parentheses of the filters when they refer to
+// a multi-value variable
+func removeQuotesForMultiVariables(filters string, variables []Variable) string {
+	for _, v := range variables {
+		if v.Multi && (strings.Contains(filters, "${"+v.Name+"}") || strings.Contains(filters, "$"+v.Name)) {
+			return strings.ReplaceAll(filters, "')", ")")
+		}
+	}
+	return filters
+}
+
+var fillSuffix = regexp.MustCompile(`_[0-9]+$`)
+
+func sampleBy(mode AlignToMode, value string, fill []string) string {
+	clause := " SAMPLE BY $__sampleByInterval"
+	if len(fill) > 0 {
+		fills := make([]string, 0, len(fill))
+		for _, f := range fill {
+			fills = append(fills, fillSuffix.ReplaceAllString(f, ""))
+		}
+		clause += fmt.Sprintf(" FILL ( %s )", strings.Join(fills, ", "))
+	}
+	if mode != "" {
+		clause += " ALIGN TO " + string(mode)
+	}
+	if (mode == AlignToCalendarOffset || mode == AlignToCalendarTimeZone) && value != "" {
+		clause += fmt.Sprintf(" '%s'", value)
+	}
+	return clause
+}
+
+func orderBy(orderBy []OrderBy) string {
+	var list []string
+	for _, o := range orderBy {
+		if o.Name != "" {
+			list = append(list, o.Name+" "+o.Dir)
+		}
+	}
+	if len(list) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(list, ", ")
+}
+
+func isBooleanType(t string) bool {
+	return strings.EqualFold(t, "boolean")
+}
+
+func isNumberType(t string) bool {
+	switch strings.ToLower(t) {
+	case "byte", "short", "int", "long", "float", "double":
+		return true
+	}
+	return false
+}
+
+func isDateType(t string) bool {
+	switch strings.ToLower(t) {
+	case "date", "timestamp", "timestamp_ns":
+		return true
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// text formats a JSON value the way the editor writes it in the query
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// truthy tells whether the editor treats the JSON value as set
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case bool:
+		return v
+	default:
+		return true
+	}
+}
@@ -0,0 +1,30 @@
+package builder
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The cases are shared with the tests of getSQLFromQueryOptions in utils.spec.ts
+func TestSQLGolden(t *testing.T) {
+	content, err := os.ReadFile("testdata/sql.golden.json")
+	require.NoError(t, err)
+	var cases []struct {
+		Name           string     `json:"name"`
+		BuilderOptions Options    `json:"builderOptions"`
+		TemplateVars   []Variable `json:"templateVars"`
+		SQL            string     `json:"sql"`
+	}
+	require.NoError(t, json.Unmarshal(content, &cases))
+	require.NotEmpty(t, cases)
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			assert.Equal(t, c.SQL, SQL(c.BuilderOptions, c.TemplateVars))
+		})
+	}
+}
@@ -3,6 +3,8 @@ package macros
 import (
 	"fmt"
 	"math"
+	"strings"
+	"time"
 	
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
 	"github.com/grafana/sqlds/v4"
@@ -15,37 +17,70 @@ const (
 	timeQueryTypeTo   timeQueryType = "to"
 )
 
-func newTimeFilter(queryType timeQueryType, query *sqlds.Query) (string, error) {
+// TimestampNs is the type of the columns with nanosecond timestamps, the others have microsecond timestamps
+const TimestampNs = "timestamp_ns"
+
+// TimeLiteral returns the time cast to the given column type, timestamp by default
+func TimeLiteral(t time.Time, columnType string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(columnType)) {
+	case "", "timestamp":
+		return fmt.Sprintf("cast(%d as timestamp)", t.UnixMicro()), nil
+	case TimestampNs:
+		return fmt.Sprintf("cast(%d as %s)", t.UnixNano(), TimestampNs), nil
+	}
+	return "", fmt.Errorf("unsupported time column type %s, expected timestamp or %s", columnType, TimestampNs)
+}
+
+func newTimeFilter(queryType timeQueryType, query *sqlds.Query, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", fmt.Errorf("%w: expected at most 1 argument, received %d", sqlutil.ErrorBadArgumentCount, len(args))
+	}
 	date := query.TimeRange.From
 	if queryType == timeQueryTypeTo {
 		date = query.TimeRange.To
 	}
 
-	return fmt.Sprintf("cast(%d as timestamp)", date.UnixMicro()), nil
+	var columnType string
+	if len(args) == 1 {
+		columnType = args[0]
+	}
+	return TimeLiteral(date, columnType)
 }
 
-// FromTimeFilter return time filter query based on grafana's timepicker's from time
+// FromTimeFilter return time filter query based on grafana's timepicker's from time, cast to the column type
+// given as optional argument
 func FromTimeFilter(query *sqlds.Query, args []string) (string, error) {
-	return newTimeFilter(timeQueryTypeFrom, query)
+	return newTimeFilter(timeQueryTypeFrom, query, args)
 }
 
-// ToTimeFilter return time filter query based on grafana's timepicker's to time
+// ToTimeFilter return time filter query based on grafana's timepicker's to time, cast to the column type
+// given as optional argument
 func ToTimeFilter(query *sqlds.Query, args []string) (string, error) {
-	return newTimeFilter(timeQueryTypeTo, query)
+	return newTimeFilter(timeQueryTypeTo, query, args)
 }
 
+// TimeFilter filters the column by the time range, with the precision of the column type given as optional
+// second argument
 func TimeFilter(query *sqlds.Query, args []string) (string, error) {
-	if len(args) != 1 {
-		return "", fmt.Errorf("%w: expected 1 argument, received %d", sqlutil.ErrorBadArgumentCount, len(args))
+	if len(args) != 1 && len(args) != 2 {
+		return "", fmt.Errorf("%w: expected 1 or 2 arguments, received %d", sqlutil.ErrorBadArgumentCount, len(args))
 	}
 
-	var (
-		column = args[0]
-		from   = query.TimeRange.From.UTC().UnixMicro()
-		to     = query.TimeRange.To.UTC().UnixMicro()
-	)
+	var columnType string
+	if len(args) == 2 {
+		columnType = args[1]
+	}
+	column := args[0]
+	from, err := TimeLiteral(query.TimeRange.From.UTC(), columnType)
+	if err != nil {
+		return "", err
+	}
+	to, err := TimeLiteral(query.TimeRange.To.UTC(), columnType)
+	if err != nil {
+		return "", err
+	}
 
-	return fmt.Sprintf("%s >= cast(%d as timestamp) AND %s <= cast(%d as timestamp)", column, from, column, to), nil
+	return fmt.Sprintf("%s >= %s AND %s <= %s", column, from, column, to), nil
 }
 
 func SampleByInterval(query *sqlds.Query, args []string) (string, error) {
@@ -66,3 +101,22 @@ func SampleByInterval(query *sqlds.Query, args []string) (string, error) {
 		return fmt.Sprintf("%dT", millis), nil
 	}
 }
+
+// TimeZone returns UTC, the time zone of the dashboard replaces $__timezone before the macros when there is one
+func TimeZone(query *sqlds.Query, args []string) (string, error) {
+	return "'UTC'", nil
+}
+
+// SampleByAlign aligns the SAMPLE BY buckets to the UTC calendar, the time zone of the dashboard replaces
+// $__sampleByAlign before the macros when there is one
+func SampleByAlign(query *sqlds.Query, args []string) (string, error) {
+	return "ALIGN TO CALENDAR TIME ZONE 'UTC'", nil
+}
+
+// Var fails the query, the $__var placeholders of the variables with a value are replaced before the macros
+func Var(query *sqlds.Query, args []string) (string, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return "", fmt.Errorf("%w: expected 1 or 2 arguments, received %d", sqlutil.ErrorBadArgumentCount, len(args))
+	}
+	return "", fmt.Errorf("template variable %s has no valid value", args[0])
+}
@@ -116,6 +116,47 @@ func TestMacroInterval1Millis(t *testing.T) {
 	}
 }
 
+func TestMacroTimeFilterPrecision(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339Nano, "2024-01-20T12:34:56.789123456Z")
+	to, _ := time.Parse(time.RFC3339Nano, "2024-02-10T10:01:02.123456789Z")
+	query := &sqlds.Query{TimeRange: backend.TimeRange{From: from, To: to}}
+	tests := []struct {
+		macro func(*sqlds.Query, []string) (string, error)
+		args  []string
+		want  string
+	}{
+		{macro: macros.TimeFilter, args: []string{"ts"}, want: "ts >= cast(1705754096789123 as timestamp) AND ts <= cast(1707559262123456 as timestamp)"},
+		{macro: macros.TimeFilter, args: []string{"ts", "timestamp"}, want: "ts >= cast(1705754096789123 as timestamp) AND ts <= cast(1707559262123456 as timestamp)"},
+		{macro: macros.TimeFilter, args: []string{"ts", "TIMESTAMP_NS"},
+			want: "ts >= cast(1705754096789123456 as timestamp_ns) AND ts <= cast(1707559262123456789 as timestamp_ns)"},
+		{macro: macros.FromTimeFilter, args: []string{"timestamp_ns"}, want: "cast(1705754096789123456 as timestamp_ns)"},
+		{macro: macros.ToTimeFilter, args: []string{"timestamp_ns"}, want: "cast(1707559262123456789 as timestamp_ns)"},
+		{macro: macros.ToTimeFilter, args: nil, want: "cast(1707559262123456 as timestamp)"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("TimeFilterPrecision_%d", i), func(t *testing.T) {
+			got, err := tt.macro(query, tt.args)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := macros.TimeFilter(query, []string{"ts", "date"})
+	assert.Error(t, err)
+	_, err = macros.FromTimeFilter(query, []string{"timestamp", "ts"})
+	assert.Error(t, err)
+}
+
+func TestMacroVar(t *testing.T) {
+	query := &sqlds.Query{RawSQL: "select * from tab where host = $__var(host)"}
+	_, err := sqlds.Interpolate(&MockDB{}, query)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "template variable host has no valid value")
+
+	_, err = macros.Var(query, []string{})
+	assert.Error(t, err)
+}
+
 func TestInterpolate(t *testing.T) {
 	from, _ := time.Parse("2006-01-02T15:04:05.000Z", "2024-01-20T12:34:56.789Z")
 	to, _ := time.Parse("2006-01-02T15:04:05.000Z", "2024-02-10T10:01:02.123Z")
@@ -139,6 +180,12 @@ func TestInterpolate(t *testing.T) {
 			output: "select * from tab where tstmp >= cast(1705754096789000 as timestamp) AND tstmp <= cast(1707559262123000 as timestamp) sample by 30s", duration: time.Duration(30000000000)},
 		{input: "select * from tab where $__timeFilter( tstmp ) sample by $__sampleByInterval",
 			output: "select * from tab where tstmp >= cast(1705754096789000 as timestamp) AND tstmp <= cast(1707559262123000 as timestamp) sample by 1T", duration: time.Duration(1000000)},
+		{input: "select * from tab where $__timeFilter(tstmp, timestamp_ns)",
+			output: "select * from tab where tstmp >= cast(1705754096789000000 as timestamp_ns) AND tstmp <= cast(1707559262123000000 as timestamp_ns)"},
+		{input: "select * from tab where tstmp between $__fromTime(timestamp_ns) and $__toTime(timestamp_ns)",
+			output: "select * from tab where tstmp between cast(1705754096789000000 as timestamp_ns) and cast(1707559262123000000 as timestamp_ns)"},
+		{input: "select to_timezone(tstmp, $__timezone) from tab sample by $__sampleByInterval $__sampleByAlign",
+			output: "select to_timezone(tstmp, 'UTC') from tab sample by 30s ALIGN TO CALENDAR TIME ZONE 'UTC'", duration: time.Duration(30000000000)},
 	}
 
 	for i, tc := range tests {
@@ -0,0 +1,244 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// AdHocFilter - ad-hoc filter of the dashboard, sent by the editor with the query. The key is a column of the table
+// of the query, optionally prefixed by the table as table.column. Values holds the values of the =| and !=| operators.
+type AdHocFilter struct {
+	Key       string   `json:"key"`
+	Operator  string   `json:"operator"`
+	Value     string   `json:"value"`
+	Values    []string `json:"values,omitempty"`
+	Condition string   `json:"condition,omitempty"`
+}
+
+// adHocOperators maps the operators of Grafana to QuestDB
+var adHocOperators = map[string]string{
+	"=":   "=",
+	"!=":  "!=",
+	"<":   "<",
+	"<=":  "<=",
+	">":   ">",
+	">=":  ">=",
+	"=~":  "~",
+	"~":   "~",
+	"!~":  "!~",
+	"=|":  "IN",
+	"!=|": "NOT IN",
+}
+
+var (
+	fromTable     = regexp.MustCompile(`(?i)\bFROM\s+"?([^\s"(),;]+)`)
+	numberLiteral = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+)
+
+// timestampLayouts are the layouts of the timestamp values accepted in ad-hoc filters, epoch milliseconds are too
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+// setAdHocFilters wraps the rawSql of the query into a query filtering its rows by the ad-hoc filters of the query.
+// A filter only applies when its table is the one the query reads from, or is at least named in the query, and its
+// column is part of the table. The filters of other tables belong to other panels of the dashboard and are left out,
+// filters with an unknown column, or a value that doesn't suit the type of the column, are left out too and reported
+// as a notice of the results.
+func setAdHocFilters(ctx context.Context, query json.RawMessage, schema *schemaResources) (json.RawMessage, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(query, &fields); err != nil {
+		return query, false, err
+	}
+	message, ok := fields["adhocFilters"]
+	if !ok || schema == nil {
+		return query, false, nil
+	}
+	var filters []AdHocFilter
+	if err := json.Unmarshal(message, &filters); err != nil {
+		return query, false, err
+	}
+	var rawSQL string
+	if err := json.Unmarshal(fields["rawSql"], &rawSQL); err != nil || len(filters) == 0 {
+		return query, false, nil
+	}
+	rawSQL = strings.TrimRight(strings.TrimSpace(rawSQL), ";")
+	if rawSQL == "" {
+		return query, false, nil
+	}
+
+	var table string
+	if match := fromTable.FindStringSubmatch(rawSQL); match != nil {
+		table = match[1]
+	}
+	// the conditions apply in the order of the filters, the predicates joined so far are grouped when it changes
+	var predicates, joiner string
+	for _, filter := range filters {
+		filterTable, column := table, filter.Key
+		if i := strings.Index(filter.Key, "."); i >= 0 {
+			filterTable, column = filter.Key[:i], filter.Key[i+1:]
+		}
+		if filterTable == "" || !mentionsTable(rawSQL, filterTable) {
+			continue
+		}
+		columns, err := schema.tableColumns(ctx, filterTable)
+		if err != nil {
+			log.DefaultLogger.Warn("QuestDB ad-hoc filters not applied, the columns of the table are unknown", "table", filterTable, "error", err)
+			queryTraceFromContext(ctx).addNotice(fmt.Sprintf("Ad-hoc filter %s %s %s ignored: the columns of %s are unknown", filter.Key, filter.Operator, filter.Value, filterTable))
+			continue
+		}
+		columnType, ok := columnTypeOf(columns, column)
+		if !ok {
+			queryTraceFromContext(ctx).addNotice(fmt.Sprintf("Ad-hoc filter %s %s %s ignored: %s has no column %s", filter.Key, filter.Operator, filter.Value, filterTable, column))
+			continue
+		}
+		predicate, err := adHocPredicate(filter, column, columnType)
+		if err != nil {
+			queryTraceFromContext(ctx).addNotice(fmt.Sprintf("Ad-hoc filter %s %s %s ignored: %s", filter.Key, filter.Operator, filter.Value, err))
+			continue
+		}
+		if predicates == "" {
+			predicates = predicate
+			continue
+		}
+		condition := strings.ToUpper(filter.Condition)
+		if condition != "OR" {
+			condition = "AND"
+		}
+		if joiner != "" && joiner != condition {
+			predicates = "(" + predicates + ")"
+		}
+		predicates += " " + condition + " " + predicate
+		joiner = condition
+	}
+	if predicates == "" {
+		return query, false, nil
+	}
+
+	fields["rawSql"], _ = json.Marshal(fmt.Sprintf("SELECT * FROM (%s) WHERE %s", rawSQL, predicates))
+	mutated, err := json.Marshal(fields)
+	if err != nil {
+		return query, false, err
+	}
+	return mutated, true, nil
+}
+
+func mentionsTable(sql, table string) bool {
+	return regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(table) + `\b`).MatchString(sql)
+}
+
+func columnTypeOf(columns []SchemaColumn, name string) (string, bool) {
+	for _, column := range columns {
+		if strings.EqualFold(column.Name, name) {
+			return strings.ToLower(column.Type), true
+		}
+	}
+	return "", false
+}
+
+// adHocPredicate returns the condition of the filter, with the values typed after the column
+func adHocPredicate(filter AdHocFilter, column, columnType string) (string, error) {
+	operator, ok := adHocOperators[filter.Operator]
+	if !ok {
+		return "", fmt.Errorf("unsupported operator %s", filter.Operator)
+	}
+	if (operator == "~" || operator == "!~") && !isStringColumn(columnType) {
+		return "", fmt.Errorf("%s is not a text column", column)
+	}
+	if columnType == "boolean" && operator != "=" && operator != "!=" && operator != "IN" && operator != "NOT IN" {
+		return "", fmt.Errorf("%s is a boolean column", column)
+	}
+
+	identifier := quoteIdentifier(column)
+	if operator == "IN" || operator == "NOT IN" {
+		values := filter.Values
+		if len(values) == 0 {
+			values = []string{filter.Value}
+		}
+		literals := make([]string, 0, len(values))
+		for _, value := range values {
+			literal, err := adHocLiteral(value, column, columnType)
+			if err != nil {
+				return "", err
+			}
+			literals = append(literals, literal)
+		}
+		return fmt.Sprintf("%s %s (%s)", identifier, operator, strings.Join(literals, ", ")), nil
+	}
+	literal, err := adHocLiteral(filter.Value, column, columnType)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %s", identifier, operator, literal), nil
+}
+
+// adHocLiteral returns the value as a literal of the type of the column
+func adHocLiteral(value, column, columnType string) (string, error) {
+	switch {
+	case isNumberColumn(columnType):
+		value = strings.TrimSpace(value)
+		if !numberLiteral.MatchString(value) {
+			return "", fmt.Errorf("%q is not a number, as %s is", value, column)
+		}
+		return value, nil
+	case columnType == "boolean":
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%q is not a boolean, as %s is", value, column)
+		}
+		return strconv.FormatBool(b), nil
+	case columnType == "timestamp" || columnType == "timestamp_ns" || columnType == "date":
+		ts, err := parseAdHocTime(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%q is not a timestamp, as %s is", value, column)
+		}
+		return fmt.Sprintf("cast('%s' as %s)", ts.UTC().Format(time.RFC3339Nano), columnType), nil
+	case columnType == "ipv4":
+		if ip := net.ParseIP(strings.TrimSpace(value)); ip == nil || ip.To4() == nil {
+			return "", fmt.Errorf("%q is not an IPv4 address, as %s is", value, column)
+		}
+		return quoteLiteral(strings.TrimSpace(value)), nil
+	default:
+		return quoteLiteral(value), nil
+	}
+}
+
+func parseAdHocTime(value string) (time.Time, error) {
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(millis), nil
+	}
+	var err error
+	for _, layout := range timestampLayouts {
+		var ts time.Time
+		if ts, err = time.Parse(layout, value); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func isNumberColumn(columnType string) bool {
+	switch columnType {
+	case "byte", "short", "int", "long", "float", "double":
+		return true
+	}
+	return strings.HasPrefix(columnType, "decimal")
+}
+
+func isStringColumn(columnType string) bool {
+	switch columnType {
+	case "string", "symbol", "varchar", "char":
+		return true
+	}
+	return false
+}
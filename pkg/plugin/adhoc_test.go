@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAdHocFilters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch query := r.URL.Query().Get("query"); {
+		case query == "SELECT 1":
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"1","type":"INT"}],"dataset":[[1]]}`)
+		case strings.Contains(query, "FROM table_columns('trades')"):
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"column","type":"STRING"},{"name":"type","type":"STRING"},{"name":"designated","type":"BOOLEAN"}],`+
+				`"dataset":[["ts","TIMESTAMP",true],["sym","SYMBOL",false],["price","DOUBLE",false],["buy","BOOLEAN",false],["ip","IPV4",false]]}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"table does not exist [table=missing]","position":0}`)
+		}
+	}))
+	defer server.Close()
+	settings, host := httpSettings(t, server)
+	connector, err := newHostConnector(settings, host, "", nil)
+	require.NoError(t, err)
+	// the connections record their queries in the trace, as in the pools of the datasource
+	db := sql.OpenDB(&queryConnector{Connector: connector})
+	defer db.Close()
+	h := &QuestDB{schema: newSchemaResources(time.Minute, func(context.Context) (*sql.DB, error) { return db, nil })}
+
+	tests := []struct {
+		name    string
+		rawSQL  string
+		filters string
+		want    string
+		notices []string
+	}{
+		{name: "should filter by a symbol", rawSQL: `SELECT * FROM trades;`, filters: `[{"key":"sym","operator":"=","value":"O'Brien"}]`,
+			want: `SELECT * FROM (SELECT * FROM trades) WHERE "sym" = 'O''Brien'`},
+		{name: "should type the values after the columns", rawSQL: `SELECT * FROM "trades"`,
+			filters: `[{"key":"trades.price","operator":">","value":"10.5"},{"key":"buy","operator":"!=","value":"TRUE","condition":"OR"},` +
+				`{"key":"ts","operator":">=","value":"1704067200000"},{"key":"ip","operator":"=","value":"10.0.0.1"},{"key":"sym","operator":"=~","value":"BTC.*"}]`,
+			want: `SELECT * FROM (SELECT * FROM "trades") WHERE ("price" > 10.5 OR "buy" != true) AND "ts" >= cast('2024-01-01T00:00:00Z' as timestamp)` +
+				` AND "ip" = '10.0.0.1' AND "sym" ~ 'BTC.*'`},
+		{name: "should apply the conditions in order", rawSQL: `SELECT * FROM trades`,
+			filters: `[{"key":"sym","operator":"=","value":"a"},{"key":"sym","operator":"=","value":"b","condition":"OR"},` +
+				`{"key":"price","operator":">","value":"1"},{"key":"buy","operator":"=","value":"true","condition":"OR"}]`,
+			want: `SELECT * FROM (SELECT * FROM trades) WHERE (("sym" = 'a' OR "sym" = 'b') AND "price" > 1) OR "buy" = true`},
+		{name: "should filter by several values", rawSQL: `SELECT * FROM trades`, filters: `[{"key":"price","operator":"!=|","values":["1","2"]}]`,
+			want: `SELECT * FROM (SELECT * FROM trades) WHERE "price" NOT IN (1, 2)`},
+		{name: "should leave out the filters of other tables", rawSQL: `SELECT * FROM trades`,
+			filters: `[{"key":"prices.sym","operator":"=","value":"a"}]`, want: `SELECT * FROM trades`},
+		{name: "should report the filters of unknown columns", rawSQL: `SELECT * FROM trades`,
+			filters: `[{"key":"venue","operator":"=","value":"b"}]`, want: `SELECT * FROM trades`,
+			notices: []string{"Ad-hoc filter venue = b ignored: trades has no column venue"}},
+		{name: "should report the invalid filters", rawSQL: `SELECT * FROM trades`,
+			filters: `[{"key":"price","operator":"=","value":"1; DROP TABLE trades"},{"key":"ts","operator":"<","value":"yesterday"},{"key":"price","operator":"=~","value":"1"}]`,
+			want:    `SELECT * FROM trades`,
+			notices: []string{
+				`Ad-hoc filter price = 1; DROP TABLE trades ignored: "1; DROP TABLE trades" is not a number, as price is`,
+				`Ad-hoc filter ts < yesterday ignored: "yesterday" is not a timestamp, as ts is`,
+				`Ad-hoc filter price =~ 1 ignored: price is not a text column`,
+			}},
+		{name: "should report the tables without columns", rawSQL: `SELECT * FROM missing`, filters: `[{"key":"sym","operator":"=","value":"a"}]`,
+			want: `SELECT * FROM missing`, notices: []string{"Ad-hoc filter sym = a ignored: the columns of missing are unknown"}},
+		{name: "should keep queries without table", rawSQL: `SELECT now()`, filters: `[{"key":"sym","operator":"=","value":"a"}]`, want: `SELECT now()`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := &queryTrace{}
+			query := fmt.Sprintf(`{"rawSql":%q,"adhocFilters":%s}`, tt.rawSQL, tt.filters)
+			_, q := h.MutateQuery(withQueryTrace(context.Background(), trace), backend.DataQuery{JSON: json.RawMessage(query)})
+			var mutated struct {
+				RawSQL string `json:"rawSql"`
+			}
+			require.NoError(t, json.Unmarshal(q.JSON, &mutated))
+			assert.Equal(t, tt.want, mutated.RawSQL)
+			assert.Equal(t, tt.notices, trace.queryNotices())
+			assert.Empty(t, trace.executedQuery())
+			assert.NoError(t, trace.error())
+		})
+	}
+}
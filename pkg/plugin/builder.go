@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/questdb/grafana-questdb-datasource/pkg/builder"
+)
+
+const queryTypeBuilder = "builder"
+
+var templateVariable = regexp.MustCompile(`\$\{?(\w+)`)
+
+// setBuilderSQL replaces the rawSql of builder queries by the SQL of their builder options, so that queries
+// saved without going through the editor, like alert rules or dashboards provisioned through the API, run what
+// the builder describes. The query is left untouched when the builder refers to dashboard variables, as they are
+// only known to the browser, which already replaced them in the rawSql.
+func setBuilderSQL(query json.RawMessage) (json.RawMessage, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(query, &fields); err != nil {
+		return query, false, err
+	}
+	var queryType string
+	if err := json.Unmarshal(fields["queryType"], &queryType); err != nil || queryType != queryTypeBuilder {
+		return query, false, nil
+	}
+	message, ok := fields["builderOptions"]
+	if !ok {
+		return query, false, nil
+	}
+	var options builder.Options
+	if err := json.Unmarshal(message, &options); err != nil {
+		return query, false, err
+	}
+	if options.Table == "" {
+		return query, false, nil
+	}
+
+	sql := builder.SQL(options, nil)
+	if hasTemplateVariables(sql) {
+		return query, false, nil
+	}
+	var rawSQL string
+	_ = json.Unmarshal(fields["rawSql"], &rawSQL)
+	if rawSQL == sql {
+		return query, false, nil
+	}
+	fields["rawSql"], _ = json.Marshal(sql)
+	mutated, err := json.Marshal(fields)
+	if err != nil {
+		return query, false, err
+	}
+	return mutated, true, nil
+}
+
+// hasTemplateVariables tells whether the query refers to variables other than the macros and global variables
+func hasTemplateVariables(sql string) bool {
+	for _, match := range templateVariable.FindAllStringSubmatch(sql, -1) {
+		if !strings.HasPrefix(match[1], "__") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetBuilderSQL(t *testing.T) {
+	options := `"builderOptions":{"mode":"list","table":"trades","fields":["sym","price"],"limit":"10"}`
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "should replace a stale rawSql", query: `{"queryType":"builder","rawSql":"SELECT sym FROM trades",` + options + `}`,
+			want: `SELECT sym, price FROM "trades" LIMIT 10`},
+		{name: "should fill a missing rawSql", query: `{"queryType":"builder",` + options + `}`, want: `SELECT sym, price FROM "trades" LIMIT 10`},
+		{name: "should keep the rawSql of SQL queries", query: `{"queryType":"sql","rawSql":"SELECT 1",` + options + `}`, want: "SELECT 1"},
+		{name: "should keep the rawSql without builder options", query: `{"queryType":"builder","rawSql":"SELECT 1"}`, want: "SELECT 1"},
+		{name: "should keep the rawSql of an incomplete builder", query: `{"queryType":"builder","rawSql":"SELECT 1","builderOptions":{"mode":"list"}}`,
+			want: "SELECT 1"},
+		{name: "should keep the rawSql interpolated by the browser",
+			query: `{"queryType":"builder","rawSql":"SELECT sym FROM \"trades\" WHERE sym = 'BTC-USD'","builderOptions":{"table":"trades","fields":["sym"],` +
+				`"filters":[{"key":"sym","type":"symbol","operator":"=","value":"${sym}"}]}}`,
+			want: `SELECT sym FROM "trades" WHERE sym = 'BTC-USD'`},
+		{name: "should generate the macros", query: `{"queryType":"builder","rawSql":"","builderOptions":{"mode":"trend","table":"trades","timeField":"ts",` +
+			`"metrics":[{"field":"price","aggregation":"avg"}]}}`,
+			want: `SELECT ts as time,  avg(price) FROM "trades" WHERE $__timeFilter(ts) SAMPLE BY $__sampleByInterval`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, q := (&QuestDB{}).MutateQuery(context.Background(), backend.DataQuery{JSON: json.RawMessage(tt.query)})
+			var query struct {
+				RawSQL string `json:"rawSql"`
+			}
+			require.NoError(t, json.Unmarshal(q.JSON, &query))
+			assert.Equal(t, tt.want, query.RawSQL)
+		})
+	}
+
+	t.Run("should keep the query when the builder options are invalid", func(t *testing.T) {
+		query := `{"queryType":"builder","rawSql":"SELECT 1","builderOptions":{"table":1}}`
+		got, mutated, err := setBuilderSQL(json.RawMessage(query))
+		assert.Error(t, err)
+		assert.False(t, mutated)
+		assert.Equal(t, query, string(got))
+	})
+}
@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/sqlds/v4"
+)
+
+const (
+	defaultCacheMaxMemory = 64 // MB
+
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+func (settings *Settings) validateCache() (errs SettingsErrors) {
+	if settings.CacheTTL < 0 {
+		errs.add("cacheTTL", ErrorMessageInvalidCache)
+	}
+	if settings.CacheMaxMemory < 0 {
+		errs.add("cacheMaxMemory", ErrorMessageInvalidCache)
+	}
+	return errs
+}
+
+// queryCache keeps the frames of recent queries for a while, so that refreshing dashboards does not run the same
+// queries again. Frames are stored in the Arrow format, which is what the memory limit accounts for, and every
+// hit returns its own copy of them. The least recently used frames are evicted first when the cache is full.
+type queryCache struct {
+	ttl       time.Duration
+	maxMemory int64
+
+	mu      sync.Mutex
+	used    int64
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	key       string
+	frames    [][]byte
+	timeRange backend.TimeRange
+	size      int64
+	expires   time.Time
+}
+
+// newQueryCache returns the cache of the datasource, nil when the cache is disabled
+func newQueryCache(settings Settings) *queryCache {
+	if settings.CacheTTL <= 0 {
+		return nil
+	}
+	return newFrameCache(time.Duration(settings.CacheTTL)*time.Second, settings.cacheMaxMemory())
+}
+
+func newFrameCache(ttl time.Duration, maxMemory int64) *queryCache {
+	return &queryCache{
+		ttl:       ttl,
+		maxMemory: maxMemory,
+		entries:   map[string]*list.Element{},
+		lru:       list.New(),
+		now:       time.Now,
+	}
+}
+
+// cacheMaxMemory returns the maximum memory of the cache in bytes
+func (settings *Settings) cacheMaxMemory() int64 {
+	maxMemory := settings.CacheMaxMemory
+	if maxMemory == 0 {
+		maxMemory = defaultCacheMaxMemory
+	}
+	return maxMemory * 1024 * 1024
+}
+
+// get returns a copy of the cached frames
+func (c *queryCache) get(key string) (data.Frames, bool) {
+	frames, _, ok := c.lookup(key)
+	return frames, ok
+}
+
+// set stores the frames, unless they alone exceed the memory limit
+func (c *queryCache) set(key string, frames data.Frames) {
+	c.store(key, frames, backend.TimeRange{})
+}
+
+// lookup returns a copy of the cached frames and the time range they were stored with
+func (c *queryCache) lookup(key string) (data.Frames, backend.TimeRange, bool) {
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, backend.TimeRange{}, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.remove(element)
+		c.mu.Unlock()
+		return nil, backend.TimeRange{}, false
+	}
+	c.lru.MoveToFront(element)
+	c.mu.Unlock()
+
+	frames, err := data.UnmarshalArrowFrames(entry.frames)
+	if err != nil {
+		return nil, backend.TimeRange{}, false
+	}
+	return frames, entry.timeRange, true
+}
+
+// store stores the frames and the time range they cover
+func (c *queryCache) store(key string, frames data.Frames, timeRange backend.TimeRange) {
+	encoded, err := frames.MarshalArrow()
+	if err != nil {
+		return
+	}
+	entry := &cacheEntry{key: key, frames: encoded, timeRange: timeRange, expires: c.now().Add(c.ttl)}
+	for _, frame := range encoded {
+		entry.size += int64(len(frame))
+	}
+	if entry.size > c.maxMemory {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	for c.used+entry.size > c.maxMemory {
+		c.remove(c.lru.Back())
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.used += entry.size
+}
+
+// delete forgets the frames of the key
+func (c *queryCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+func (c *queryCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.used -= entry.size
+}
+
+// alignTimeRange aligns the time range of the query to its interval, so that the macros expand to the same SQL and
+// the cache keys match across refreshes. The range is widened, the end is moved to the end of its interval.
+func alignTimeRange(query backend.DataQuery) backend.DataQuery {
+	if query.Interval <= 0 {
+		return query
+	}
+	from := query.TimeRange.From.Truncate(query.Interval)
+	to := query.TimeRange.To.Truncate(query.Interval)
+	if to.Before(query.TimeRange.To) {
+		to = to.Add(query.Interval)
+	}
+	query.TimeRange = backend.TimeRange{From: from, To: to}
+	return query
+}
+
+// queryKey identifies the results of a query by its macro expanded SQL, its parameters, its format and its time range
+func queryKey(query backend.DataQuery) (string, error) {
+	q, err := sqlds.GetQuery(query, nil, false)
+	if err != nil {
+		return "", err
+	}
+	// the $__var placeholders are only replaced in MutateQuery, their values are part of the parameters
+	q.RawSQL = strings.ReplaceAll(q.RawSQL, "$__var(", "__var(")
+	sql, err := sqlds.Interpolate(&QuestDB{}, q)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	for _, part := range append([]string{
+		sql,
+		strconv.Itoa(int(q.Format)),
+		strconv.FormatInt(query.TimeRange.From.UnixNano(), 10),
+		strconv.FormatInt(query.TimeRange.To.UnixNano(), 10),
+	}, queryParameters(query)...) {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// queryParameters returns the fields of the query that MutateQuery turns into SQL, as JSON
+func queryParameters(query backend.DataQuery) []string {
+	var fields map[string]json.RawMessage
+	_ = json.Unmarshal(query.JSON, &fields)
+	return []string{string(fields["builderOptions"]), string(fields["adhocFilters"]), string(fields["templateVariables"]), string(fields["meta"])}
+}
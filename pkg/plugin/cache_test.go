@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCacheFrames(values ...int64) data.Frames {
+	return data.Frames{data.NewFrame("result", data.NewField("value", nil, values))}
+}
+
+func TestQueryCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newQueryCache(Settings{CacheTTL: 10})
+	require.NotNil(t, cache)
+	cache.now = func() time.Time { return now }
+
+	_, ok := cache.get("a")
+	assert.False(t, ok)
+
+	cache.set("a", newCacheFrames(1, 2, 3))
+	frames, ok := cache.get("a")
+	require.True(t, ok)
+	assert.Equal(t, []int64{1, 2, 3}, []int64{frames[0].Fields[0].At(0).(int64), frames[0].Fields[0].At(1).(int64), frames[0].Fields[0].At(2).(int64)})
+
+	// every hit gets its own copy
+	frames[0].Fields[0].Set(0, int64(42))
+	frames, _ = cache.get("a")
+	assert.Equal(t, int64(1), frames[0].Fields[0].At(0))
+
+	now = now.Add(11 * time.Second)
+	_, ok = cache.get("a")
+	assert.False(t, ok)
+	assert.Zero(t, cache.used)
+	assert.Empty(t, cache.entries)
+
+	assert.Nil(t, newQueryCache(Settings{}))
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	cache := newQueryCache(Settings{CacheTTL: 10})
+	encoded, err := newCacheFrames(1, 2, 3).MarshalArrow()
+	require.NoError(t, err)
+	size := int64(len(encoded[0]))
+	cache.maxMemory = 2 * size
+
+	cache.set("a", newCacheFrames(1, 2, 3))
+	cache.set("b", newCacheFrames(4, 5, 6))
+	_, ok := cache.get("a")
+	assert.True(t, ok)
+
+	// b is the least recently used
+	cache.set("c", newCacheFrames(7, 8, 9))
+	_, ok = cache.get("b")
+	assert.False(t, ok)
+	_, ok = cache.get("a")
+	assert.True(t, ok)
+	_, ok = cache.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 2*size, cache.used)
+
+	// frames larger than the cache are not stored
+	cache.set("d", newCacheFrames(make([]int64, 10000)...))
+	_, ok = cache.get("d")
+	assert.False(t, ok)
+	assert.Len(t, cache.entries, 2)
+}
+
+func TestAlignTimeRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 0, 12, 0, time.UTC)
+	to := time.Date(2024, 1, 1, 11, 0, 12, 0, time.UTC)
+	query := alignTimeRange(backend.DataQuery{Interval: time.Minute, TimeRange: backend.TimeRange{From: from, To: to}})
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), query.TimeRange.From)
+	assert.Equal(t, time.Date(2024, 1, 1, 11, 1, 0, 0, time.UTC), query.TimeRange.To)
+
+	aligned := time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)
+	query = alignTimeRange(backend.DataQuery{Interval: time.Minute, TimeRange: backend.TimeRange{From: from, To: aligned}})
+	assert.Equal(t, aligned, query.TimeRange.To)
+
+	query = alignTimeRange(backend.DataQuery{TimeRange: backend.TimeRange{From: from, To: to}})
+	assert.Equal(t, from, query.TimeRange.From)
+}
+
+func TestQueryKey(t *testing.T) {
+	newQuery := func(sql string, from, to time.Time) backend.DataQuery {
+		return alignTimeRange(backend.DataQuery{
+			RefID:     "A",
+			Interval:  time.Minute,
+			TimeRange: backend.TimeRange{From: from, To: to},
+			JSON:      []byte(`{"rawSql": "` + sql + `", "format": 1}`),
+		})
+	}
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	sql := "SELECT * FROM trades WHERE $__timeFilter(ts)"
+
+	key, err := queryKey(newQuery(sql, from, to))
+	require.NoError(t, err)
+
+	// a refresh a few seconds later falls into the same intervals
+	refresh, err := queryKey(newQuery(sql, from.Add(5*time.Second), to.Add(-5*time.Second)))
+	require.NoError(t, err)
+	assert.Equal(t, key, refresh)
+
+	later, err := queryKey(newQuery(sql, from.Add(time.Minute), to.Add(time.Minute)))
+	require.NoError(t, err)
+	assert.NotEqual(t, key, later)
+
+	other, err := queryKey(newQuery("SELECT 1", from, to))
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+
+	_, err = queryKey(newQuery("SELECT 1 WHERE $__timeFilter(a, b)", from, to))
+	assert.Error(t, err)
+}
+
+func TestCacheHitStats(t *testing.T) {
+	ds := &Datasource{cache: newQueryCache(Settings{CacheTTL: 10})}
+	query := alignTimeRange(backend.DataQuery{
+		RefID:     "B",
+		Interval:  time.Minute,
+		TimeRange: backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()},
+		JSON:      []byte(`{"rawSql": "SELECT * FROM trades"}`),
+	})
+	key, err := queryKey(query)
+	require.NoError(t, err)
+	frames := newCacheFrames(1)
+	addStats(frames, queryTimings{response: time.Millisecond, fetch: time.Millisecond, rows: 1})
+	require.NotEmpty(t, frames[0].Meta.Stats)
+	ds.cache.set(key, frames)
+
+	// the hit did not run the query, the timings of the query that stored it are dropped
+	response := ds.runQuery(context.Background(), &backend.QueryDataRequest{}, query)
+	require.NoError(t, response.Error)
+	require.Len(t, response.Frames, 1)
+	assert.Equal(t, "B", response.Frames[0].RefID)
+	assert.Empty(t, response.Frames[0].Meta.Stats)
+	assert.Equal(t, cacheHit, response.Frames[0].Meta.Custom.(map[string]interface{})["cache"])
+}
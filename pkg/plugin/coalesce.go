@@ -0,0 +1,97 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryGroup coalesces identical concurrent queries: the first one runs, the others wait for its response.
+// The shared query keeps running while at least one of the callers waits for it, it is cancelled when all of them
+// gave up, so that a closed dashboard does not cancel the query of another user.
+type queryGroup struct {
+	mu    sync.Mutex
+	calls map[string]*queryCall
+}
+
+type queryCall struct {
+	done     chan struct{}
+	response backend.DataResponse
+	waiters  int
+	cancel   context.CancelFunc
+}
+
+func newQueryGroup() *queryGroup {
+	return &queryGroup{calls: map[string]*queryCall{}}
+}
+
+// do runs the query, unless an identical one is already running, and returns a copy of the response.
+// shared tells whether the response is the one of a query started by another caller.
+func (g *queryGroup) do(ctx context.Context, key string, query func(ctx context.Context) backend.DataResponse) (response backend.DataResponse, shared bool) {
+	g.mu.Lock()
+	call, shared := g.calls[key]
+	if !shared {
+		queryCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &queryCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go func() {
+			defer cancel()
+			call.response = query(queryCtx)
+			g.mu.Lock()
+			g.forget(key, call)
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return copyResponse(call.response), shared
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// later callers must not join a cancelled query
+			g.forget(key, call)
+			call.cancel()
+		}
+		g.mu.Unlock()
+		queryErr := classifyError(ctx.Err())
+		return backend.DataResponse{Error: queryErr, Status: queryErr.Status(), ErrorSource: queryErr.Source}, shared
+	}
+}
+
+func (g *queryGroup) forget(key string, call *queryCall) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// copyResponse copies the frames of a shared response and their metadata, the fields are shared
+func copyResponse(response backend.DataResponse) backend.DataResponse {
+	if response.Frames == nil {
+		return response
+	}
+	frames := make(data.Frames, len(response.Frames))
+	for i, frame := range response.Frames {
+		f := *frame
+		if frame.Meta != nil {
+			meta := *frame.Meta
+			if custom, ok := meta.Custom.(map[string]interface{}); ok {
+				copied := make(map[string]interface{}, len(custom))
+				for k, v := range custom {
+					copied[k] = v
+				}
+				meta.Custom = copied
+			}
+			f.Meta = &meta
+		}
+		frames[i] = &f
+	}
+	response.Frames = frames
+	return response
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryGroup(t *testing.T) {
+	t.Run("should share the response of identical concurrent queries", func(t *testing.T) {
+		group := newQueryGroup()
+		release := make(chan struct{})
+		var runs atomic.Int32
+		query := func(ctx context.Context) backend.DataResponse {
+			runs.Add(1)
+			<-release
+			frame := data.NewFrame("result", data.NewField("value", nil, []int64{1}))
+			frame.SetMeta(&data.FrameMeta{Custom: map[string]interface{}{"attempts": 1}})
+			return backend.DataResponse{Frames: data.Frames{frame}}
+		}
+
+		var wg sync.WaitGroup
+		responses := make([]backend.DataResponse, 5)
+		shared := make([]bool, 5)
+		for i := range responses {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				responses[i], shared[i] = group.do(context.Background(), "key", query)
+			}()
+		}
+		require.Eventually(t, func() bool {
+			group.mu.Lock()
+			defer group.mu.Unlock()
+			return group.calls["key"] != nil && group.calls["key"].waiters == 5
+		}, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), runs.Load())
+		sharedCount := 0
+		for i, response := range responses {
+			require.Len(t, response.Frames, 1)
+			if shared[i] {
+				sharedCount++
+			}
+		}
+		assert.Equal(t, 4, sharedCount)
+		assert.Empty(t, group.calls)
+
+		// every caller gets its own frames and metadata
+		responses[0].Frames[0].RefID = "A"
+		setCustomMeta(responses[0].Frames, "coalesced", true)
+		assert.Empty(t, responses[1].Frames[0].RefID)
+		assert.Equal(t, map[string]interface{}{"attempts": 1}, responses[1].Frames[0].Meta.Custom)
+	})
+
+	t.Run("should run queries with distinct keys", func(t *testing.T) {
+		group := newQueryGroup()
+		var runs atomic.Int32
+		query := func(ctx context.Context) backend.DataResponse {
+			runs.Add(1)
+			return backend.DataResponse{}
+		}
+		_, shared := group.do(context.Background(), "a", query)
+		assert.False(t, shared)
+		_, shared = group.do(context.Background(), "b", query)
+		assert.False(t, shared)
+		assert.Equal(t, int32(2), runs.Load())
+	})
+
+	t.Run("should cancel the query when every caller gave up", func(t *testing.T) {
+		group := newQueryGroup()
+		cancelled := make(chan struct{})
+		query := func(ctx context.Context) backend.DataResponse {
+			<-ctx.Done()
+			close(cancelled)
+			return backend.DataResponse{Error: ctx.Err()}
+		}
+
+		first, cancelFirst := context.WithCancel(context.Background())
+		second, cancelSecond := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		for _, ctx := range []context.Context{first, second} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				response, _ := group.do(ctx, "key", query)
+				assert.ErrorIs(t, response.Error, context.Canceled)
+			}()
+		}
+		require.Eventually(t, func() bool {
+			group.mu.Lock()
+			defer group.mu.Unlock()
+			return group.calls["key"] != nil && group.calls["key"].waiters == 2
+		}, time.Second, time.Millisecond)
+
+		cancelFirst()
+		select {
+		case <-cancelled:
+			t.Fatal("the query must keep running while a caller waits for it")
+		case <-time.After(20 * time.Millisecond):
+		}
+		cancelSecond()
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("the query must be cancelled when every caller gave up")
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,366 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/sqlds/v4"
+)
+
+// Datasource wraps the generic SQL datasource with QuestDB specific handlers
+type Datasource struct {
+	*sqlds.SQLDatasource
+	settings Settings
+	cache    *queryCache
+	refresh  *queryCache
+	queries  *queryGroup
+	streams  *streams
+	schema   *schemaResources
+	driver   *QuestDB
+
+	// settingsErrors are the invalid settings of the datasource, which then has no connection
+	settingsErrors SettingsErrors
+}
+
+// NewDatasource creates a QuestDB datasource instance.
+// A datasource with invalid settings is still created, so that CheckHealth can report every invalid setting.
+func NewDatasource(ctx context.Context, config backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
+	settings, err := LoadSettings(config)
+	if err != nil {
+		var settingsErrors SettingsErrors
+		if !errors.As(err, &settingsErrors) {
+			return nil, err
+		}
+		log.DefaultLogger.Warn("QuestDB datasource settings are invalid", "error", err)
+		return &Datasource{settings: settings, settingsErrors: settingsErrors, streams: newStreams()}, nil
+	}
+	driver := &QuestDB{transport: settings.Transport}
+	ds := sqlds.NewDatasource(driver)
+	// connection arguments select the pool, see setConnectionArgs
+	ds.EnableMultipleConnections = true
+	if _, err := ds.NewDatasource(ctx, config); err != nil {
+		return nil, err
+	}
+	schema := newSchemaResources(settings.schemaCacheTTL(), func(ctx context.Context) (*sql.DB, error) {
+		return ds.GetDBFromQuery(ctx, &sqlds.Query{})
+	})
+	driver.schema = schema
+	return &Datasource{SQLDatasource: ds, settings: settings, cache: newQueryCache(settings),
+		refresh: newRefreshCache(settings), queries: newQueryGroup(), streams: newStreams(), schema: schema, driver: driver}, nil
+}
+
+// QueryData routes queries of the alerting engine to the alerting pool, so that heavy dashboards don't delay alert evaluations.
+// Every query is run on its own, so that its failure can be classified and retried according to the retry policy.
+func (ds *Datasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	if ds.settingsErrors != nil {
+		res := backend.NewQueryDataResponse()
+		for _, query := range req.Queries {
+			res.Responses[query.RefID] = backend.ErrDataResponseWithSource(backend.StatusBadRequest, backend.ErrorSourceDownstream,
+				fmt.Sprintf("invalid datasource settings: %s", ds.settingsErrors))
+		}
+		return res, nil
+	}
+	pool := poolDefault
+	if ds.settings.EnableAlertingPool && isAlertingRequest(req) {
+		pool = poolAlerting
+		ctx = withPool(ctx, pool)
+	}
+	// sqlds applies the longest timeout of the pools, see driverTimeout
+	if timeout := ds.settings.queryTimeout(pool); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	res := backend.NewQueryDataResponse()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, query := range req.Queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response := ds.runQuery(ctx, req, query)
+			if isStreaming(query) {
+				ds.stream(req, query, response)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			res.Responses[query.RefID] = response
+		}()
+	}
+	wg.Wait()
+	return res, nil
+}
+
+// runQuery answers a query from the cache when possible, otherwise runs it and caches its frames. With the incremental
+// refresh, only the tail of the time range is fetched and merged into the last result of the query.
+// Queries of the alerting engine are neither cached nor refreshed incrementally, alert rules must not be evaluated
+// against stale data.
+func (ds *Datasource) runQuery(ctx context.Context, req *backend.QueryDataRequest, query backend.DataQuery) backend.DataResponse {
+	reusable := isIdempotent(query) && !isAlertingRequest(req)
+	cached := ds.cache != nil && reusable
+	if cached {
+		query = alignTimeRange(query)
+	}
+	var key string
+	if cached {
+		var err error
+		if key, err = queryKey(query); err != nil {
+			log.DefaultLogger.Debug("QuestDB query is not cached", "refId", query.RefID, "error", err)
+			cached = false
+		}
+	}
+	if cached {
+		if frames, ok := ds.cache.get(key); ok {
+			for _, frame := range frames {
+				frame.RefID = query.RefID
+			}
+			clearStats(frames)
+			setCustomMeta(frames, "cache", cacheHit)
+			return backend.DataResponse{Frames: frames}
+		}
+	}
+
+	var refreshKey string
+	var incremental incrementalQuery
+	executed := query
+	if ds.refresh != nil && reusable {
+		var ok bool
+		if refreshKey, ok = refreshKeyOf(query, poolFromContext(ctx)); ok {
+			overlap := time.Duration(ds.settings.IncrementalRefreshOverlap) * time.Second
+			incremental, executed, _ = ds.refresh.tail(refreshKey, query, overlap)
+		}
+	}
+
+	response, shared := ds.execute(ctx, req, executed)
+	refresh := refreshFull
+	if incremental.key != "" && response.Error == nil {
+		if merged, ok := mergeTail(incremental.previous, response.Frames, query.TimeRange.From, incremental.tailFrom); ok {
+			response.Frames = merged
+			refresh = refreshIncremental
+		} else {
+			log.DefaultLogger.Debug("QuestDB query tail cannot be merged, fetching the whole time range", "refId", query.RefID)
+			response, shared = ds.execute(ctx, req, query)
+		}
+	}
+
+	if !shared && response.Error == nil {
+		if refreshKey != "" {
+			ds.refresh.storeTail(refreshKey, response.Frames, query.TimeRange)
+		}
+		if cached {
+			ds.cache.set(key, response.Frames)
+		}
+	}
+	if shared {
+		setCustomMeta(response.Frames, "coalesced", true)
+	}
+	if refreshKey != "" {
+		setCustomMeta(response.Frames, "refresh", refresh)
+	}
+	if cached {
+		setCustomMeta(response.Frames, "cache", cacheMiss)
+	}
+	return response
+}
+
+// execute runs the query with the retry policy. Identical idempotent queries running at the same time are coalesced
+// into a single one, shared tells whether the response is the one of a query started by another request.
+func (ds *Datasource) execute(ctx context.Context, req *backend.QueryDataRequest, query backend.DataQuery) (response backend.DataResponse, shared bool) {
+	idempotent := isIdempotent(query)
+	policy := ds.settings.retryPolicy()
+	run := func(ctx context.Context) backend.DataResponse {
+		response, attempts := policy.do(ctx, idempotent, func(ctx context.Context) backend.DataResponse {
+			return ds.queryOne(ctx, req, query)
+		})
+		if policy.enabled() {
+			setCustomMeta(response.Frames, "attempts", attempts)
+		}
+		return response
+	}
+	if !idempotent {
+		return run(ctx), false
+	}
+	key, err := queryKey(query)
+	if err != nil {
+		return run(ctx), false
+	}
+
+	// queries of distinct pools are not coalesced, each pool has its own timeouts
+	response, shared = ds.queries.do(ctx, poolFromContext(ctx)+"/"+key, run)
+	for _, frame := range response.Frames {
+		frame.RefID = query.RefID
+	}
+	return response, shared
+}
+
+// queryOne runs a single query of the request with sqlds. The timings of the query are added to the statistics of
+// the frames. A failure reported by the driver is classified, the error position is added to the custom metadata
+// of the frame so that the editor can highlight it.
+func (ds *Datasource) queryOne(ctx context.Context, req *backend.QueryDataRequest, query backend.DataQuery) backend.DataResponse {
+	single := *req
+	single.Queries = []backend.DataQuery{query}
+	res, err := ds.SQLDatasource.QueryData(ctx, &single)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusInternal, err.Error())
+	}
+	response := res.Responses[query.RefID]
+	trace := queryTraceFromContext(ctx)
+	if trace != nil {
+		addStats(response.Frames, trace.queryTimings())
+		addNotices(response.Frames, trace.queryNotices())
+	}
+	if response.Error == nil || trace == nil || trace.error() == nil {
+		return response
+	}
+
+	queryErr := classifyError(trace.error())
+	queryErr.locate(trace.executedQuery())
+	response.Error = queryErr
+	response.Status = queryErr.Status()
+	response.ErrorSource = queryErr.Source
+	if len(response.Frames) == 0 {
+		response.Frames = data.Frames{data.NewFrame("").SetMeta(&data.FrameMeta{ExecutedQueryString: trace.executedQuery()})}
+	}
+	setCustomMeta(response.Frames, "error", queryErr)
+	return response
+}
+
+// setCustomMeta adds a QuestDB specific value to the custom metadata of the frames
+func setCustomMeta(frames data.Frames, key string, value interface{}) {
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok {
+			custom = map[string]interface{}{}
+			frame.Meta.Custom = custom
+		}
+		custom[key] = value
+	}
+}
+
+// addNotices adds the warnings of the query to the frames, shown by the panels
+func addNotices(frames data.Frames, notices []string) {
+	for _, frame := range frames {
+		for _, text := range notices {
+			frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: text})
+		}
+	}
+}
+
+// HealthDetails - structured details returned by CheckHealth
+type HealthDetails struct {
+	Version   string          `json:"version,omitempty"`
+	Latency   float64         `json:"latencyMs,omitempty"`
+	TLS       *TLSDetails     `json:"tls,omitempty"`
+	Proxy     bool            `json:"proxy"`
+	SshTunnel bool            `json:"sshTunnel"`
+	Tables    *TablesDetails  `json:"tables,omitempty"`
+	Session   []SessionStatus `json:"session,omitempty"`
+	Hosts     []HostStatus    `json:"hosts,omitempty"`
+	Errors    SettingsErrors  `json:"errors,omitempty"`
+}
+
+// CheckHealth runs the generic SQL health check, then diagnoses the connection and adds the status of every configured host.
+// The details hold whatever could be collected, also when the generic check fails.
+func (ds *Datasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
+	if ds.settingsErrors != nil {
+		return settingsHealth(ds.settingsErrors), nil
+	}
+
+	res, err := ds.SQLDatasource.CheckHealth(ctx, req)
+	if err != nil || req.PluginContext.DataSourceInstanceSettings == nil {
+		return res, err
+	}
+
+	details := HealthDetails{}
+	if connector, err := newConnector(ctx, *req.PluginContext.DataSourceInstanceSettings, ds.settings); err == nil {
+		ds.diagnoseHealth(ctx, connector, res, &details)
+		connector.Close()
+	}
+	if res.JSONDetails, err = json.Marshal(details); err != nil {
+		log.DefaultLogger.Error("QuestDB health details serialization failed", "error", err)
+	}
+	return res, nil
+}
+
+// diagnoseHealth fills the details in, the result of the generic check is completed with the failures it doesn't tell,
+// like the session statement that failed
+func (ds *Datasource) diagnoseHealth(ctx context.Context, connector *failoverConnector, res *backend.CheckHealthResult, details *HealthDetails) {
+	err := diagnose(ctx, connector, details)
+	if statements := ds.settings.sessionStatements(); len(statements) > 0 {
+		details.Session = sessionStatus(statements, err)
+	}
+	var statementErr *InitStatementError
+	switch {
+	case errors.As(err, &statementErr):
+		res.Status = backend.HealthStatusError
+		res.Message = statementErr.Error()
+	case res.Status != backend.HealthStatusOk:
+	case err != nil:
+		res.Status = backend.HealthStatusError
+		res.Message = fmt.Sprintf("QuestDB diagnostics failed: %s", err)
+	case !details.Tables.Readable:
+		res.Message = fmt.Sprintf("%s, but tables() is not readable: %s", res.Message, details.Tables.Error)
+	}
+
+	if len(ds.settings.Hosts) > 0 {
+		details.Hosts = connector.Status(ctx)
+		up := 0
+		for _, host := range details.Hosts {
+			if host.Up {
+				up++
+			}
+		}
+		if res.Status == backend.HealthStatusOk && up < len(details.Hosts) {
+			res.Message = fmt.Sprintf("%s. %d of %d hosts are reachable", res.Message, up, len(details.Hosts))
+		}
+	}
+}
+
+// settingsHealth reports every invalid setting, the details list them by field for the configuration editor
+func settingsHealth(settingsErrors SettingsErrors) *backend.CheckHealthResult {
+	res := &backend.CheckHealthResult{
+		Status:  backend.HealthStatusError,
+		Message: fmt.Sprintf("Invalid settings: %s", settingsErrors),
+	}
+	details, err := json.Marshal(HealthDetails{Errors: settingsErrors})
+	if err != nil {
+		log.DefaultLogger.Error("QuestDB health details serialization failed", "error", err)
+	}
+	res.JSONDetails = details
+	return res
+}
+
+// CallResource serves the schema of QuestDB, other resources are served by sqlds.
+// It fails when the settings are invalid, as there is no connection to query the schema with.
+func (ds *Datasource) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if ds.settingsErrors != nil {
+		return sender.Send(&backend.CallResourceResponse{
+			Status: http.StatusBadRequest,
+			Body:   []byte(fmt.Sprintf("invalid datasource settings: %s", ds.settingsErrors)),
+		})
+	}
+	if ds.schema.handles(req.Path) {
+		return ds.schema.handler.CallResource(ctx, req, sender)
+	}
+	return ds.SQLDatasource.CallResource(ctx, req, sender)
+}
+
+// Dispose closes the connections, if any
+func (ds *Datasource) Dispose() {
+	if ds.SQLDatasource != nil {
+		ds.SQLDatasource.Dispose()
+	}
+}
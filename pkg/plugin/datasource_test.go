@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidSettingsDatasource(t *testing.T) {
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{ "server": "foo", "port": "abc", "username": "bar" }`),
+	})
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+
+	res, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusError, res.Status)
+	assert.Contains(t, res.Message, "port: expected an integer")
+	assert.Contains(t, res.Message, "password: ")
+
+	var details HealthDetails
+	require.NoError(t, json.Unmarshal(res.JSONDetails, &details))
+	require.Len(t, details.Errors, 2)
+	assert.Equal(t, "port", details.Errors[0].Field)
+	assert.Equal(t, "password", details.Errors[1].Field)
+
+	queries, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{{RefID: "A"}}})
+	require.NoError(t, err)
+	assert.Equal(t, backend.ErrorSourceDownstream, queries.Responses["A"].ErrorSource)
+	assert.ErrorContains(t, queries.Responses["A"].Error, "invalid datasource settings")
+}
+
+func TestCheckHealthFailureDetails(t *testing.T) {
+	// no server listens on the ports
+	ports := make([]int, 2)
+	for i := range ports {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		ports[i] = listener.Addr().(*net.TCPAddr).Port
+		require.NoError(t, listener.Close())
+	}
+	config := backend.DataSourceInstanceSettings{
+		JSONData: []byte(fmt.Sprintf(`{"server": "127.0.0.1", "port": %d, "username": "admin", "tlsMode": "disable", "timeout": 2,
+			"hosts": [{"server": "127.0.0.1", "port": %d, "priority": 1}]}`, ports[0], ports[1])),
+		DecryptedSecureJSONData: map[string]string{"password": "quest"},
+	}
+	instance, err := NewDatasource(context.Background(), config)
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+
+	res, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: &config},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusError, res.Status)
+
+	var details HealthDetails
+	require.NoError(t, json.Unmarshal(res.JSONDetails, &details))
+	require.Len(t, details.Hosts, 2)
+	assert.False(t, details.Hosts[0].Up)
+	assert.False(t, details.Hosts[1].Up)
+	assert.False(t, details.Proxy)
+	assert.Nil(t, details.Tables)
+}
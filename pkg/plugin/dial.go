@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/lib/pq"
+)
+
+// questdbDialer is implemented by all the dialers used to reach QuestDB. pq uses the context variant
+// whenever it is available, so that a cancelled request also aborts the dial.
+type questdbDialer interface {
+	pq.Dialer
+	pq.DialerContext
+}
+
+// keepAliveConfig returns the TCP keepalive configuration of the connections to QuestDB and to the SSH bastion.
+// Unset values fall back to the Go defaults: the first probe after 15s of idle time, then every 15s, up to 9 probes.
+func (settings *Settings) keepAliveConfig() net.KeepAliveConfig {
+	return net.KeepAliveConfig{
+		Enable:   !settings.DisableKeepAlive,
+		Idle:     time.Duration(settings.KeepAliveIdle) * time.Second,
+		Interval: time.Duration(settings.KeepAliveInterval) * time.Second,
+		Count:    int(settings.KeepAliveCount),
+	}
+}
+
+func (settings *Settings) validateKeepAlive() (errs SettingsErrors) {
+	for field, value := range map[string]int64{
+		"keepAliveIdle":     settings.KeepAliveIdle,
+		"keepAliveInterval": settings.KeepAliveInterval,
+		"keepAliveCount":    settings.KeepAliveCount,
+	} {
+		if value < 0 {
+			errs.add(field, ErrorMessageInvalidKeepAlive)
+		}
+	}
+	return errs
+}
+
+// directDialer connects to QuestDB without a proxy, with the configured keepalives,
+// and logs the time spent resolving the host name and establishing the TCP connection
+type directDialer struct {
+	dialer   *net.Dialer
+	resolver *net.Resolver
+}
+
+func newDirectDialer(settings Settings) *directDialer {
+	dialer := &net.Dialer{KeepAliveConfig: settings.keepAliveConfig()}
+	if settings.DisableKeepAlive {
+		dialer.KeepAlive = -1
+	}
+	return &directDialer{dialer: dialer, resolver: net.DefaultResolver}
+}
+
+// Dial implements pq.Dialer
+func (d *directDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialTimeout implements pq.Dialer
+func (d *directDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+// DialContext implements pq.DialerContext
+func (d *directDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// unix sockets are not resolved
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	start := time.Now()
+	addresses := []string{host}
+	if net.ParseIP(host) == nil {
+		if addresses, err = d.resolver.LookupHost(ctx, host); err != nil {
+			log.DefaultLogger.Debug("QuestDB host name resolution failed", "address", address, "dns", time.Since(start), "error", err)
+			return nil, err
+		}
+	}
+	dns := time.Since(start)
+
+	start = time.Now()
+	var conn net.Conn
+	for _, a := range addresses {
+		if conn, err = d.dialer.DialContext(ctx, network, net.JoinHostPort(a, port)); err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		log.DefaultLogger.Debug("QuestDB TCP connection failed", "address", address, "dns", dns, "tcp", time.Since(start), "error", err)
+		return nil, err
+	}
+	log.DefaultLogger.Debug("QuestDB TCP connection established", "address", address, "remote", conn.RemoteAddr().String(),
+		"dns", dns, "tcp", time.Since(start))
+	return conn, nil
+}
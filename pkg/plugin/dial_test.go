@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingDialer never connects, with or without a context
+type blockingDialer struct {
+	release chan struct{}
+}
+
+func (d *blockingDialer) Dial(_, _ string) (net.Conn, error) {
+	<-d.release
+	return nil, assert.AnError
+}
+
+type blockingContextDialer struct {
+	blockingDialer
+}
+
+func (d *blockingContextDialer) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestPostgresProxyDialer(t *testing.T) {
+	for name, d := range map[string]*postgresProxyDialer{
+		"context dialer": {d: &blockingContextDialer{}},
+		"plain dialer":   {d: &blockingDialer{release: make(chan struct{})}},
+	} {
+		t.Run("should abort the dial when the request is cancelled with a "+name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			start := time.Now()
+			_, err := d.DialContext(ctx, "tcp", "questdb:8812")
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Less(t, time.Since(start), 5*time.Second)
+			if plain, ok := d.d.(*blockingDialer); ok {
+				close(plain.release)
+			}
+		})
+	}
+
+	t.Run("should record that the proxy carried the connection", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		d := &postgresProxyDialer{d: &net.Dialer{}}
+		trace := &dialTrace{}
+		conn, err := d.DialContext(withDialTrace(context.Background(), trace), "tcp", listener.Addr().String())
+		require.NoError(t, err)
+		_ = conn.Close()
+		proxy, sshTunnel := trace.route()
+		assert.True(t, proxy)
+		assert.False(t, sshTunnel)
+	})
+
+	t.Run("should apply the timeout", func(t *testing.T) {
+		d := &postgresProxyDialer{d: &blockingContextDialer{}}
+		_, err := d.DialTimeout("tcp", "questdb:8812", 50*time.Millisecond)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestDirectDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	d := newDirectDialer(Settings{KeepAliveIdle: 30, KeepAliveInterval: 10, KeepAliveCount: 3})
+	assert.Equal(t, net.KeepAliveConfig{Enable: true, Idle: 30 * time.Second, Interval: 10 * time.Second, Count: 3}, d.dialer.KeepAliveConfig)
+
+	conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("localhost", port))
+	require.NoError(t, err)
+	_ = conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = d.DialContext(ctx, "tcp", net.JoinHostPort("questdb.invalid", port))
+	assert.Error(t, err)
+
+	disabled := newDirectDialer(Settings{DisableKeepAlive: true})
+	assert.False(t, disabled.dialer.KeepAliveConfig.Enable)
+	assert.Negative(t, disabled.dialer.KeepAlive)
+}
+
+func TestValidateKeepAlive(t *testing.T) {
+	settings := Settings{KeepAliveIdle: -1, KeepAliveCount: -1}
+	errs := settings.validateKeepAlive()
+	require.Len(t, errs, 2)
+	assert.ErrorIs(t, errs[0], ErrorMessageInvalidKeepAlive)
+}
@@ -13,8 +13,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/lib/pq"
-
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/api/types/mount"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -141,7 +139,38 @@ func TestConnect(t *testing.T) {
 	}
 }
 
+func TestCheckHealthDetails(t *testing.T) {
+	config := backend.DataSourceInstanceSettings{
+		JSONData: []byte(fmt.Sprintf(`{ "server": "%s", "port": %s, "username": "%s", "tlsMode": "disable" }`,
+			getEnv("QUESTDB_HOST", "localhost"), getEnv("QUESTDB_PORT", "8812"), getEnv("QUESTDB_USERNAME", "admin"))),
+		DecryptedSecureJSONData: map[string]string{"password": getEnv("QUESTDB_PASSWORD", "quest")},
+	}
+	instance, err := plugin.NewDatasource(context.Background(), config)
+	require.NoError(t, err)
+	ds := instance.(*plugin.Datasource)
+	defer ds.Dispose()
+
+	res, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: &config},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusOk, res.Status, res.Message)
+
+	var details plugin.HealthDetails
+	require.NoError(t, json.Unmarshal(res.JSONDetails, &details))
+	assert.Contains(t, details.Version, "QuestDB")
+	assert.Greater(t, details.Latency, float64(0))
+	assert.Nil(t, details.TLS)
+	assert.False(t, details.Proxy)
+	require.NotNil(t, details.Tables)
+	assert.True(t, details.Tables.Readable)
+}
+
 func setupConnection(t *testing.T) *sql.DB {
+	return setupDriverConnection(t, "")
+}
+
+func setupDriverConnection(t testing.TB, driver string) *sql.DB {
 	port, err := strconv.ParseInt(getEnv("QUESTDB_PORT", "8812"), 10, 64)
 	if err != nil {
 		panic(err)
@@ -170,7 +199,7 @@ func setupConnection(t *testing.T) *sql.DB {
 		tlsMode = "disable"
 	}
 
-	cnnstr, err := plugin.GenerateConnectionString(plugin.Settings{
+	connector, err := plugin.NewConnector(plugin.Settings{
 		Server:              host,
 		Port:                port,
 		Username:            username,
@@ -178,12 +207,12 @@ func setupConnection(t *testing.T) *sql.DB {
 		TlsMode:             tlsMode,
 		ConfigurationMethod: tlsConfigurationMethod,
 		TlsCACert:           string(tlsCaCert),
+		Driver:              driver,
 	}, "version")
 	if err != nil {
 		panic(err)
 	}
 
-	connector, err := pq.NewConnector(cnnstr)
 	conn := sql.OpenDB(connector)
 	return conn
 }
@@ -262,6 +291,121 @@ func TestInsertAndQueryData(t *testing.T) {
 	}
 }
 
+func TestServerSideCancellation(t *testing.T) {
+	for _, driver := range []string{"pq", "pgx"} {
+		t.Run("should stop the query on the server when the context is cancelled with "+driver, func(t *testing.T) {
+			conn := setupDriverConnection(t, driver)
+			defer conn.Close()
+
+			const query = "SELECT count() FROM long_sequence(100000000000) WHERE rnd_double() > 0.5"
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			_, err := conn.ExecContext(ctx, query)
+			require.Error(t, err)
+
+			assert.Eventually(t, func() bool {
+				var running int
+				err := conn.QueryRow("SELECT count() FROM query_activity() WHERE query = $1", query).Scan(&running)
+				return err == nil && running == 0
+			}, 10*time.Second, 100*time.Millisecond)
+		})
+	}
+}
+
+// streamPackets collects the packets pushed to a Live channel
+type streamPackets chan json.RawMessage
+
+func (p streamPackets) Send(packet *backend.StreamPacket) error {
+	p <- packet.Data
+	return nil
+}
+
+func TestRunStream(t *testing.T) {
+	conn := setupConnection(t)
+	defer conn.Close()
+	_, err := conn.Exec("DROP TABLE IF EXISTS stream_trades")
+	require.NoError(t, err)
+	_, err = conn.Exec("CREATE TABLE stream_trades (ts TIMESTAMP, price DOUBLE) TIMESTAMP(ts) PARTITION BY DAY BYPASS WAL")
+	require.NoError(t, err)
+	_, err = conn.Exec("INSERT INTO stream_trades VALUES (dateadd('m', -1, now()), 1.0)")
+	require.NoError(t, err)
+
+	config := backend.DataSourceInstanceSettings{
+		UID: "questdb",
+		JSONData: []byte(fmt.Sprintf(`{ "server": "%s", "port": %s, "username": "%s", "tlsMode": "disable", "streamPollInterval": 100 }`,
+			getEnv("QUESTDB_HOST", "localhost"), getEnv("QUESTDB_PORT", "8812"), getEnv("QUESTDB_USERNAME", "admin"))),
+		DecryptedSecureJSONData: map[string]string{"password": getEnv("QUESTDB_PASSWORD", "quest")},
+	}
+	instance, err := plugin.NewDatasource(context.Background(), config)
+	require.NoError(t, err)
+	ds := instance.(*plugin.Datasource)
+	defer ds.Dispose()
+
+	now := time.Now()
+	res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: &config},
+		Queries: []backend.DataQuery{{
+			RefID:     "A",
+			TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+			JSON:      []byte(`{"rawSql": "SELECT ts, price FROM stream_trades WHERE $__timeFilter(ts)", "format": 1, "stream": true}`),
+		}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, res.Responses["A"].Error)
+	frame := res.Responses["A"].Frames[0]
+	require.Equal(t, 1, frame.Rows())
+	require.True(t, strings.HasPrefix(frame.Meta.Channel, "ds/questdb/"))
+	path := strings.TrimPrefix(frame.Meta.Channel, "ds/questdb/")
+
+	subscription, err := ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: path})
+	require.NoError(t, err)
+	require.Equal(t, backend.SubscribeStreamStatusOK, subscription.Status)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	packets := make(streamPackets, 10)
+	done := make(chan error)
+	go func() {
+		done <- ds.RunStream(ctx, &backend.RunStreamRequest{Path: path}, backend.NewStreamSender(packets))
+	}()
+
+	_, err = conn.Exec("INSERT INTO stream_trades VALUES (now(), 2.0)")
+	require.NoError(t, err)
+	select {
+	case packet := <-packets:
+		var pushed data.Frame
+		require.NoError(t, json.Unmarshal(packet, &pushed))
+		require.Equal(t, 1, pushed.Rows())
+		assert.Equal(t, 2.0, *pushed.Fields[1].At(0).(*float64))
+	case <-time.After(10 * time.Second):
+		t.Fatal("the new row was not pushed")
+	}
+	cancel()
+	require.NoError(t, <-done)
+}
+
+// BenchmarkDecode compares how fast the drivers read and convert a million rows into a data frame
+func BenchmarkDecode(b *testing.B) {
+	const rows = 1_000_000
+	query := fmt.Sprintf("SELECT timestamp_sequence(0, 1000000) ts, rnd_double() d, rnd_long() l, rnd_int() i, rnd_symbol('a', 'b', 'c') s "+
+		"FROM long_sequence(%d)", rows)
+
+	for _, driver := range []string{"pq", "pgx"} {
+		b.Run(driver, func(b *testing.B) {
+			conn := setupDriverConnection(b, driver)
+			defer conn.Close()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r, err := conn.Query(query)
+				require.NoError(b, err)
+				frame, err := sqlutil.FrameFromRows(r, -1, converters.QdbConverters...)
+				require.NoError(b, err)
+				require.Equal(b, rows, frame.Rows())
+			}
+			b.ReportMetric(float64(rows*b.N)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
+
 func mktimestamp(s string, t *testing.T) *time.Time {
 	timestamp, err := time.ParseInLocation("2006-01-02T15:04:05.999999", s, time.UTC)
 	require.NoError(t, err)
@@ -1,6 +1,18 @@
 package plugin
 
-import "github.com/pkg/errors"
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
 
 var (
 	ErrorMessageInvalidJSON       = errors.New("could not parse json")
@@ -8,4 +20,293 @@ var (
 	ErrorMessageInvalidPort       = errors.New("invalid port")
 	ErrorMessageInvalidUserName   = errors.New("username is either empty or not set")
 	ErrorMessageInvalidPassword   = errors.New("password is either empty or not set")
+	ErrorMessageInvalidDriver     = errors.New("invalid driver. Expected pq or pgx")
+	ErrorMessageInvalidTransport  = errors.New("invalid transport. Expected pgwire or http")
+	ErrorMessageHttpSession       = errors.New("custom settings and session statements are not supported by the HTTP transport")
+
+	ErrorMessageInvalidSettingType = errors.New("invalid value type")
+	ErrorMessageInvalidKeepAlive   = errors.New("TCP keepalive idle time, interval and count must not be negative")
+
+	ErrorMessageInvalidSshHost       = errors.New("invalid SSH tunnel host. Host must be set and port must not be negative")
+	ErrorMessageInvalidSshUser       = errors.New("SSH tunnel user is either empty or not set")
+	ErrorMessageInvalidSshKey        = errors.New("SSH tunnel private key is either empty or not valid")
+	ErrorMessageInvalidSshKnownHosts = errors.New("SSH tunnel known hosts must pin the host key of the bastion in the known_hosts format")
+
+	ErrorMessageInvalidRetryPolicy = errors.New("retry attempts, backoff and jitter must not be negative")
+	ErrorMessageInvalidCache       = errors.New("cache TTL and maximum memory must not be negative")
+
+	ErrorMessageInvalidIncrementalRefresh = errors.New("incremental refresh overlap must not be negative")
+	ErrorMessageInvalidStream             = errors.New("stream poll interval and maximum rows must not be negative")
+	ErrorMessageInvalidSchemaCache        = errors.New("schema cache TTL must not be negative")
+
+	ErrorMessageInvalidCustomSetting = errors.New("invalid custom setting. The name must be a valid identifier")
+	ErrorMessageInvalidInitStatement = errors.New("invalid session statement. It must be a single non-empty statement")
+
+	ErrorMessageInvalidHost              = errors.New("invalid host. Server must be set, port must be positive and priority must not be negative")
+	ErrorMessageDuplicateHost            = errors.New("duplicate host")
+	ErrorMessageInvalidHostProbeInterval = errors.New("invalid host probe interval")
+	ErrorMessageInvalidAlertingPort      = errors.New("invalid alerting port")
+	ErrorMessageInvalidAlertingPool      = errors.New("alerting pool timeouts and connection limits must not be negative")
+
+	ErrorMessageInvalidTlsFile           = errors.New("TLS/SSL file is missing or not readable")
+	ErrorMessageInvalidTlsCACertFile     = errors.New("TLS/SSL root certificate file does not contain a valid PEM certificate")
+	ErrorMessageInvalidTlsClientCertFile = errors.New("TLS/SSL client certificate and key files must both be set and contain a valid key pair")
+	ErrorMessageInvalidTlsCACert         = errors.New("TLS/SSL root certificate is not a valid PEM certificate")
+	ErrorMessageInvalidTlsMinVersion     = errors.New("invalid TLS/SSL minimum version. Expected one of 1.0, 1.1, 1.2 or 1.3")
+	ErrorMessageTlsNotSupported          = errors.New("TLS/SSL is not enabled on the server")
 )
+
+// SettingsError - invalid value of a single setting
+type SettingsError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+	err    error
+}
+
+func newSettingsError(field string, err error) *SettingsError {
+	return &SettingsError{Field: field, Reason: err.Error(), err: err}
+}
+
+func (e *SettingsError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+}
+
+func (e *SettingsError) Unwrap() error {
+	return e.err
+}
+
+// SettingsErrors - all the invalid settings of a datasource
+type SettingsErrors []*SettingsError
+
+func (e *SettingsErrors) add(field string, err error) {
+	*e = append(*e, newSettingsError(field, err))
+}
+
+func (e SettingsErrors) has(field string) bool {
+	for _, err := range e {
+		if err.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// orNil returns nil when there are no errors, so that callers can compare the result to nil
+func (e SettingsErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e SettingsErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e SettingsErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// QueryErrorKind - category of a query failure
+type QueryErrorKind string
+
+const (
+	QueryErrorSyntax         QueryErrorKind = "syntax"
+	QueryErrorTableNotFound  QueryErrorKind = "tableNotFound"
+	QueryErrorColumnNotFound QueryErrorKind = "columnNotFound"
+	QueryErrorFunction       QueryErrorKind = "function"
+	QueryErrorPermission     QueryErrorKind = "permission"
+	QueryErrorConnection     QueryErrorKind = "connection"
+	QueryErrorUnavailable    QueryErrorKind = "unavailable"
+	QueryErrorBusy           QueryErrorKind = "busy"
+	QueryErrorTimeout        QueryErrorKind = "timeout"
+	QueryErrorCancelled      QueryErrorKind = "cancelled"
+	QueryErrorResource       QueryErrorKind = "resource"
+	QueryErrorInvalidQuery   QueryErrorKind = "invalidQuery"
+	QueryErrorInternal       QueryErrorKind = "internal"
+)
+
+// QueryError - classified failure of a query. Position is the 1-based character position of the offending token
+// in the executed SQL as reported by QuestDB, 0 when unknown. Line and Column locate it for the query editor.
+type QueryError struct {
+	Kind     QueryErrorKind      `json:"kind"`
+	Code     string              `json:"code,omitempty"`
+	Message  string              `json:"message"`
+	Position int                 `json:"position,omitempty"`
+	Line     int                 `json:"line,omitempty"`
+	Column   int                 `json:"column,omitempty"`
+	Source   backend.ErrorSource `json:"source"`
+	err      error
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.err
+}
+
+// Status returns the status of the query response
+func (e *QueryError) Status() backend.Status {
+	switch e.Kind {
+	case QueryErrorSyntax, QueryErrorTableNotFound, QueryErrorColumnNotFound, QueryErrorFunction, QueryErrorInvalidQuery, QueryErrorCancelled:
+		return backend.StatusBadRequest
+	case QueryErrorPermission:
+		return backend.StatusForbidden
+	case QueryErrorConnection, QueryErrorUnavailable:
+		return backend.StatusBadGateway
+	case QueryErrorBusy, QueryErrorResource:
+		return backend.StatusTooManyRequests
+	case QueryErrorTimeout:
+		return backend.StatusTimeout
+	default:
+		return backend.StatusInternal
+	}
+}
+
+// transient tells whether the failure is expected to go away by itself, e.g. a connection reset,
+// a restarting server or a busy table
+func (e *QueryError) transient() bool {
+	return e.Kind == QueryErrorConnection || e.Kind == QueryErrorUnavailable || e.Kind == QueryErrorBusy
+}
+
+// locate sets the line and column of the error position in the executed SQL
+func (e *QueryError) locate(sql string) {
+	if e.Position <= 0 {
+		return
+	}
+	line, column := 1, 1
+	for i, r := range []rune(sql) {
+		if i == e.Position-1 {
+			e.Line, e.Column = line, column
+			return
+		}
+		if r == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+}
+
+// sqlStateKinds - SQLSTATE codes, or classes of two characters, and their kind
+var sqlStateKinds = map[string]QueryErrorKind{
+	"42601": QueryErrorSyntax,
+	"42P01": QueryErrorTableNotFound,
+	"42703": QueryErrorColumnNotFound,
+	"42883": QueryErrorFunction,
+	"42501": QueryErrorPermission,
+	"28":    QueryErrorPermission,
+	"08":    QueryErrorConnection,
+	"57P01": QueryErrorUnavailable, // admin_shutdown
+	"57P02": QueryErrorUnavailable, // crash_shutdown
+	"57P03": QueryErrorUnavailable, // cannot_connect_now
+	"53300": QueryErrorUnavailable, // too_many_connections
+	"53":    QueryErrorResource,
+	"57014": QueryErrorTimeout, // query_canceled
+	"40001": QueryErrorBusy,    // serialization_failure
+	"40P01": QueryErrorBusy,    // deadlock_detected
+}
+
+// httpStatusKinds - status codes of the HTTP transport not caused by the query itself
+var httpStatusKinds = map[int]QueryErrorKind{
+	http.StatusUnauthorized:       QueryErrorPermission,
+	http.StatusForbidden:          QueryErrorPermission,
+	http.StatusTooManyRequests:    QueryErrorBusy,
+	http.StatusBadGateway:         QueryErrorUnavailable,
+	http.StatusServiceUnavailable: QueryErrorUnavailable,
+	http.StatusGatewayTimeout:     QueryErrorUnavailable,
+}
+
+// questdbMessageKinds - QuestDB reports most errors with the 00000 SQLSTATE, they are classified by message
+var questdbMessageKinds = []struct {
+	message string
+	kind    QueryErrorKind
+}{
+	{message: "table busy", kind: QueryErrorBusy},
+	{message: "table is busy", kind: QueryErrorBusy},
+	{message: "server is restarting", kind: QueryErrorUnavailable},
+	{message: "server is shutting down", kind: QueryErrorUnavailable},
+	{message: "connection reset", kind: QueryErrorConnection},
+	{message: "broken pipe", kind: QueryErrorConnection},
+	{message: "table does not exist", kind: QueryErrorTableNotFound},
+	{message: "invalid column", kind: QueryErrorColumnNotFound},
+	{message: "unknown function", kind: QueryErrorFunction},
+	{message: "no matching function", kind: QueryErrorFunction},
+	{message: "permission denied", kind: QueryErrorPermission},
+	{message: "access denied", kind: QueryErrorPermission},
+	{message: "timeout, query aborted", kind: QueryErrorTimeout},
+	{message: "cancelled by user", kind: QueryErrorCancelled},
+	{message: "out of memory", kind: QueryErrorResource},
+	{message: "memory limit", kind: QueryErrorResource},
+	{message: "unexpected token", kind: QueryErrorSyntax},
+	{message: "dangling", kind: QueryErrorSyntax},
+	{message: "syntax error", kind: QueryErrorSyntax},
+}
+
+// classifyError maps the error returned by the driver to a QueryError. Errors reported by QuestDB and failures to reach
+// it are downstream errors, anything else is a plugin error.
+func classifyError(err error) *QueryError {
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		return queryErr
+	}
+	e := &QueryError{Kind: QueryErrorInternal, Message: err.Error(), Source: backend.ErrorSourceDownstream, err: err}
+
+	var pqErr *pq.Error
+	var pgErr *pgconn.PgError
+	var httpErr *HttpQueryError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Kind = QueryErrorTimeout
+	case errors.Is(err, context.Canceled):
+		e.Kind = QueryErrorCancelled
+	case errors.As(err, &pqErr):
+		e.Kind, e.Code, e.Message = QueryErrorInvalidQuery, string(pqErr.Code), pqErr.Message
+		e.Position, _ = strconv.Atoi(pqErr.Position)
+	case errors.As(err, &pgErr):
+		e.Kind, e.Code, e.Message = QueryErrorInvalidQuery, pgErr.Code, pgErr.Message
+		e.Position = int(pgErr.Position)
+	case errors.As(err, &httpErr):
+		e.Kind, e.Message, e.Position = httpStatusKinds[httpErr.StatusCode], httpErr.Message, httpErr.Position
+		if e.Kind == "" {
+			e.Kind = QueryErrorInvalidQuery
+		}
+	case errors.Is(err, driver.ErrBadConn) || isConnectionError(err):
+		e.Kind = QueryErrorConnection
+	}
+
+	if kind, ok := sqlStateKinds[e.Code]; ok {
+		e.Kind = kind
+	} else if kind, ok := sqlStateKinds[prefix(e.Code, 2)]; ok {
+		e.Kind = kind
+	} else if e.Kind == QueryErrorInternal || e.Kind == QueryErrorInvalidQuery {
+		message := strings.ToLower(e.Message)
+		for _, m := range questdbMessageKinds {
+			if strings.Contains(message, m.message) {
+				e.Kind = m.kind
+				break
+			}
+		}
+	}
+	if e.Kind == QueryErrorInternal {
+		e.Source = backend.ErrorSourcePlugin
+	}
+	return e
+}
+
+func prefix(s string, n int) string {
+	if len(s) < n {
+		return s
+	}
+	return s[:n]
+}
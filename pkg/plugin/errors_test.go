@@ -0,0 +1,114 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		description string
+		err         error
+		kind        QueryErrorKind
+		source      backend.ErrorSource
+		status      backend.Status
+		code        string
+		position    int
+	}{
+		{
+			description: "should classify syntax errors by SQLSTATE",
+			err:         &pq.Error{Code: "42601", Message: "syntax error at or near \"form\"", Position: "10"},
+			kind:        QueryErrorSyntax, source: backend.ErrorSourceDownstream, status: backend.StatusBadRequest, code: "42601", position: 10,
+		},
+		{
+			description: "should classify QuestDB syntax errors by message",
+			err:         &pgconn.PgError{Code: "00000", Message: "unexpected token [form]", Position: 10},
+			kind:        QueryErrorSyntax, source: backend.ErrorSourceDownstream, status: backend.StatusBadRequest, code: "00000", position: 10,
+		},
+		{
+			description: "should classify missing tables",
+			err:         &pq.Error{Code: "00000", Message: "table does not exist [table=trades]", Position: "15"},
+			kind:        QueryErrorTableNotFound, source: backend.ErrorSourceDownstream, status: backend.StatusBadRequest, code: "00000", position: 15,
+		},
+		{
+			description: "should classify missing columns",
+			err:         &pgconn.PgError{Code: "00000", Message: "Invalid column: pricee", Position: 8},
+			kind:        QueryErrorColumnNotFound, source: backend.ErrorSourceDownstream, status: backend.StatusBadRequest, code: "00000", position: 8,
+		},
+		{
+			description: "should classify permission errors by SQLSTATE class",
+			err:         &pq.Error{Code: "28P01", Message: "invalid username/password"},
+			kind:        QueryErrorPermission, source: backend.ErrorSourceDownstream, status: backend.StatusForbidden, code: "28P01",
+		},
+		{
+			description: "should classify busy tables",
+			err:         &pq.Error{Code: "00000", Message: "table busy [reason=insert]"},
+			kind:        QueryErrorBusy, source: backend.ErrorSourceDownstream, status: backend.StatusTooManyRequests, code: "00000",
+		},
+		{
+			description: "should classify restarting servers",
+			err:         &pgconn.PgError{Code: "57P01", Message: "terminating connection due to administrator command"},
+			kind:        QueryErrorUnavailable, source: backend.ErrorSourceDownstream, status: backend.StatusBadGateway, code: "57P01",
+		},
+		{
+			description: "should classify connection resets",
+			err:         fmt.Errorf("read tcp: %w", syscall.ECONNRESET),
+			kind:        QueryErrorConnection, source: backend.ErrorSourceDownstream, status: backend.StatusBadGateway,
+		},
+		{
+			description: "should classify timeouts",
+			err:         fmt.Errorf("query: %w", context.DeadlineExceeded),
+			kind:        QueryErrorTimeout, source: backend.ErrorSourceDownstream, status: backend.StatusTimeout,
+		},
+		{
+			description: "should classify server side timeouts",
+			err:         &pq.Error{Code: "00000", Message: "timeout, query aborted [fd=12]"},
+			kind:        QueryErrorTimeout, source: backend.ErrorSourceDownstream, status: backend.StatusTimeout, code: "00000",
+		},
+		{
+			description: "should classify other QuestDB errors as invalid queries",
+			err:         &pq.Error{Code: "00000", Message: "inconvertible types: STRING -> TIMESTAMP"},
+			kind:        QueryErrorInvalidQuery, source: backend.ErrorSourceDownstream, status: backend.StatusBadRequest, code: "00000",
+		},
+		{
+			description: "should classify other errors as plugin errors",
+			err:         errors.New("unsupported column type"),
+			kind:        QueryErrorInternal, source: backend.ErrorSourcePlugin, status: backend.StatusInternal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			queryErr := classifyError(tt.err)
+			assert.Equal(t, tt.kind, queryErr.Kind)
+			assert.Equal(t, tt.source, queryErr.Source)
+			assert.Equal(t, tt.status, queryErr.Status())
+			assert.Equal(t, tt.code, queryErr.Code)
+			assert.Equal(t, tt.position, queryErr.Position)
+			assert.ErrorIs(t, queryErr, tt.err)
+		})
+	}
+}
+
+func TestQueryErrorLocate(t *testing.T) {
+	queryErr := &QueryError{Position: 19}
+	queryErr.locate("SELECT price\nFROM tradez\nLIMIT 10")
+	assert.Equal(t, 2, queryErr.Line)
+	assert.Equal(t, 6, queryErr.Column)
+
+	queryErr = &QueryError{Position: 1}
+	queryErr.locate("SELEC 1")
+	assert.Equal(t, 1, queryErr.Line)
+	assert.Equal(t, 1, queryErr.Column)
+
+	queryErr = &QueryError{Position: 100}
+	queryErr.locate("SELECT 1")
+	assert.Zero(t, queryErr.Line)
+}
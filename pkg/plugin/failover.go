@@ -0,0 +1,288 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultHostProbeInterval = 30 * time.Second
+
+// endpoint is a single QuestDB server together with its connector and last known state
+type endpoint struct {
+	host      Host
+	connector driver.Connector
+
+	mu      sync.Mutex
+	down    bool
+	lastErr error
+}
+
+func (e *endpoint) isDown() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.down
+}
+
+func (e *endpoint) setState(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil && !e.down {
+		log.DefaultLogger.Warn("QuestDB host is down", "host", e.host.String(), "error", err)
+	} else if err == nil && e.down {
+		log.DefaultLogger.Info("QuestDB host is up again", "host", e.host.String())
+	}
+	e.down = err != nil
+	e.lastErr = err
+}
+
+// HostStatus describes the reachability of a single QuestDB host
+type HostStatus struct {
+	Server   string `json:"server"`
+	Port     int64  `json:"port"`
+	Priority int64  `json:"priority"`
+	Up       bool   `json:"up"`
+	Error    string `json:"error,omitempty"`
+}
+
+// failoverConnector opens connections to the most preferred QuestDB host that is reachable.
+// Hosts sharing a priority are picked round-robin. Hosts that refuse connections are marked
+// as down and re-probed periodically, so that the pool moves back once they recover.
+type failoverConnector struct {
+	endpoints     []*endpoint
+	probeInterval time.Duration
+	next          atomic.Uint32
+
+	// closers are closed with the connector, e.g. the SSH tunnel shared by the endpoints
+	closers []io.Closer
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+func newFailoverConnector(endpoints []*endpoint, probeInterval time.Duration) *failoverConnector {
+	c := &failoverConnector{
+		endpoints:     endpoints,
+		probeInterval: probeInterval,
+		stop:          make(chan struct{}),
+	}
+	if len(endpoints) > 1 && probeInterval > 0 {
+		go c.probeLoop()
+	}
+	return c
+}
+
+// Connect implements driver.Connector
+func (c *failoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var lastErr error
+	// healthy hosts are tried first, hosts marked as down are only a last resort
+	for _, wantDown := range []bool{false, true} {
+		for _, e := range c.candidates(wantDown) {
+			conn, err := e.connector.Connect(ctx)
+			if err == nil {
+				e.setState(nil)
+				return &failoverConn{Conn: conn, endpoint: e, connector: c}, nil
+			}
+			if !isConnectionError(err) || ctx.Err() != nil {
+				return nil, err
+			}
+			e.setState(err)
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// Driver implements driver.Connector
+func (c *failoverConnector) Driver() driver.Driver {
+	return c.endpoints[0].connector.Driver()
+}
+
+// Close stops the background probing, it is called by sql.DB.Close
+func (c *failoverConnector) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		for _, closer := range c.closers {
+			_ = closer.Close()
+		}
+	})
+	return nil
+}
+
+// candidates returns the endpoints in the given state ordered by priority,
+// rotating endpoints of equal priority to spread the connections.
+func (c *failoverConnector) candidates(down bool) []*endpoint {
+	offset := int(c.next.Add(1))
+	var result []*endpoint
+	for start := 0; start < len(c.endpoints); {
+		end := start
+		for end < len(c.endpoints) && c.endpoints[end].host.Priority == c.endpoints[start].host.Priority {
+			end++
+		}
+		group := c.endpoints[start:end]
+		for i := range group {
+			e := group[(i+offset)%len(group)]
+			if e.isDown() == down {
+				result = append(result, e)
+			}
+		}
+		start = end
+	}
+	return result
+}
+
+// preferred reports whether no reachable endpoint has a better priority than the given one
+func (c *failoverConnector) preferred(e *endpoint) bool {
+	for _, other := range c.endpoints {
+		if other.host.Priority >= e.host.Priority {
+			return true
+		}
+		if !other.isDown() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *failoverConnector) probeLoop() {
+	ticker := time.NewTicker(c.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			for _, e := range c.endpoints {
+				if e.isDown() {
+					c.probe(context.Background(), e)
+				}
+			}
+		}
+	}
+}
+
+func (c *failoverConnector) probe(ctx context.Context, e *endpoint) error {
+	ctx, cancel := context.WithTimeout(ctx, c.probeInterval)
+	defer cancel()
+	conn, err := e.connector.Connect(ctx)
+	if err == nil {
+		err = conn.Close()
+	}
+	e.setState(err)
+	return err
+}
+
+// Status probes every endpoint and reports whether it is reachable
+func (c *failoverConnector) Status(ctx context.Context) []HostStatus {
+	statuses := make([]HostStatus, len(c.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range c.endpoints {
+		wg.Add(1)
+		go func(i int, e *endpoint) {
+			defer wg.Done()
+			status := HostStatus{Server: e.host.Server, Port: e.host.Port, Priority: e.host.Priority, Up: true}
+			if err := c.probe(ctx, e); err != nil {
+				status.Up = false
+				status.Error = err.Error()
+			}
+			statuses[i] = status
+		}(i, e)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// isConnectionError reports whether the error means the host could not be reached,
+// as opposed to an error returned by a running server (e.g. bad credentials).
+// A channel rejected by the SSH bastion means that it could not reach the host.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	var channelErr *ssh.OpenChannelError
+	return errors.As(err, &netErr) ||
+		errors.As(err, &channelErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+// failoverConn remembers the endpoint it is connected to, so that it is dropped
+// from the pool as soon as a more preferred endpoint becomes available again
+type failoverConn struct {
+	driver.Conn
+	endpoint  *endpoint
+	connector *failoverConnector
+}
+
+func (c *failoverConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *failoverConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *failoverConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *failoverConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() //nolint:staticcheck
+}
+
+func (c *failoverConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *failoverConn) ResetSession(ctx context.Context) error {
+	if !c.connector.preferred(c.endpoint) {
+		return driver.ErrBadConn
+	}
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *failoverConn) IsValid() bool {
+	if !c.connector.preferred(c.endpoint) {
+		return false
+	}
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *failoverConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
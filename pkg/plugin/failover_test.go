@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	driver.Conn
+	host string
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+type fakeConnector struct {
+	host string
+
+	mu       sync.Mutex
+	err      error
+	attempts int
+}
+
+func (c *fakeConnector) Connect(_ context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &fakeConn{host: c.host}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver { return nil }
+
+func (c *fakeConnector) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+var errRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func newTestFailover(probeInterval time.Duration, hosts ...Host) (*failoverConnector, map[string]*fakeConnector) {
+	fakes := map[string]*fakeConnector{}
+	var endpoints []*endpoint
+	for _, host := range hosts {
+		fake := &fakeConnector{host: host.Server}
+		fakes[host.Server] = fake
+		endpoints = append(endpoints, &endpoint{host: host, connector: fake})
+	}
+	return newFailoverConnector(endpoints, probeInterval), fakes
+}
+
+func connectedHost(t *testing.T, c *failoverConnector) string {
+	conn, err := c.Connect(context.Background())
+	require.NoError(t, err)
+	return conn.(*failoverConn).Conn.(*fakeConn).host
+}
+
+func TestFailoverConnector(t *testing.T) {
+	t.Run("should prefer the primary", func(t *testing.T) {
+		c, _ := newTestFailover(0, Host{Server: "primary"}, Host{Server: "replica", Priority: 1})
+		defer c.Close()
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, "primary", connectedHost(t, c))
+		}
+	})
+
+	t.Run("should balance hosts of equal priority", func(t *testing.T) {
+		c, _ := newTestFailover(0, Host{Server: "a"}, Host{Server: "b"}, Host{Server: "replica", Priority: 1})
+		defer c.Close()
+		seen := map[string]bool{}
+		for i := 0; i < 4; i++ {
+			seen[connectedHost(t, c)] = true
+		}
+		assert.Equal(t, map[string]bool{"a": true, "b": true}, seen)
+	})
+
+	t.Run("should fail over when the primary refuses connections", func(t *testing.T) {
+		c, fakes := newTestFailover(0, Host{Server: "primary"}, Host{Server: "replica", Priority: 1})
+		defer c.Close()
+		fakes["primary"].setErr(errRefused)
+		assert.Equal(t, "replica", connectedHost(t, c))
+		assert.True(t, c.endpoints[0].isDown())
+
+		// hosts marked as down are not tried first anymore
+		assert.Equal(t, "replica", connectedHost(t, c))
+		assert.Equal(t, 1, fakes["primary"].attempts)
+	})
+
+	t.Run("should not fail over on server errors", func(t *testing.T) {
+		c, fakes := newTestFailover(0, Host{Server: "primary"}, Host{Server: "replica", Priority: 1})
+		defer c.Close()
+		authErr := errors.New("invalid username/password")
+		fakes["primary"].setErr(authErr)
+		_, err := c.Connect(context.Background())
+		assert.Equal(t, authErr, err)
+		assert.Equal(t, 0, fakes["replica"].attempts)
+	})
+
+	t.Run("should return the last error when all hosts are down", func(t *testing.T) {
+		c, fakes := newTestFailover(0, Host{Server: "primary"}, Host{Server: "replica", Priority: 1})
+		defer c.Close()
+		fakes["primary"].setErr(errRefused)
+		fakes["replica"].setErr(errRefused)
+		_, err := c.Connect(context.Background())
+		assert.ErrorIs(t, err, errRefused)
+	})
+
+	t.Run("should move back to the primary once it recovers", func(t *testing.T) {
+		c, fakes := newTestFailover(10*time.Millisecond, Host{Server: "primary"}, Host{Server: "replica", Priority: 1})
+		defer c.Close()
+		fakes["primary"].setErr(errRefused)
+		conn, err := c.Connect(context.Background())
+		require.NoError(t, err)
+		replicaConn := conn.(*failoverConn)
+		assert.True(t, replicaConn.IsValid())
+
+		fakes["primary"].setErr(nil)
+		assert.Eventually(t, func() bool { return !c.endpoints[0].isDown() }, time.Second, 5*time.Millisecond)
+		assert.False(t, replicaConn.IsValid())
+		assert.ErrorIs(t, replicaConn.ResetSession(context.Background()), driver.ErrBadConn)
+		assert.Equal(t, "primary", connectedHost(t, c))
+	})
+
+	t.Run("should report status of every host", func(t *testing.T) {
+		c, fakes := newTestFailover(0, Host{Server: "primary", Port: 8812}, Host{Server: "replica", Port: 8812, Priority: 1})
+		defer c.Close()
+		fakes["replica"].setErr(errRefused)
+		assert.Equal(t, []HostStatus{
+			{Server: "primary", Port: 8812, Priority: 0, Up: true},
+			{Server: "replica", Port: 8812, Priority: 1, Up: false, Error: errRefused.Error()},
+		}, c.Status(context.Background()))
+	})
+}
@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// TLSDetails - TLS/SSL session negotiated with the server
+type TLSDetails struct {
+	Version               string    `json:"version"`
+	CipherSuite           string    `json:"cipherSuite"`
+	ServerName            string    `json:"serverName,omitempty"`
+	PeerCertificateExpiry time.Time `json:"peerCertificateExpiry"`
+}
+
+// TablesDetails - whether the user can list the tables with tables()
+type TablesDetails struct {
+	Readable bool   `json:"readable"`
+	Count    int64  `json:"count"`
+	Error    string `json:"error,omitempty"`
+}
+
+// dialTrace records how a connection was established, the dialers fill it in when it is found in the context
+type dialTrace struct {
+	mu        sync.Mutex
+	tls       *tls.ConnectionState
+	proxy     bool
+	sshTunnel bool
+}
+
+type dialTraceKey struct{}
+
+func withDialTrace(ctx context.Context, trace *dialTrace) context.Context {
+	return context.WithValue(ctx, dialTraceKey{}, trace)
+}
+
+func dialTraceFromContext(ctx context.Context) *dialTrace {
+	trace, _ := ctx.Value(dialTraceKey{}).(*dialTrace)
+	return trace
+}
+
+func (t *dialTrace) setTLS(state tls.ConnectionState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tls = &state
+}
+
+func (t *dialTrace) tlsState() *tls.ConnectionState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tls
+}
+
+// setProxy records that the connection went through the secure socks proxy
+func (t *dialTrace) setProxy() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.proxy = true
+}
+
+// setSshTunnel records that the connection went through the SSH tunnel
+func (t *dialTrace) setSshTunnel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sshTunnel = true
+}
+
+// route tells whether the connection went through the secure socks proxy and the SSH tunnel
+func (t *dialTrace) route() (proxy, sshTunnel bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.proxy, t.sshTunnel
+}
+
+func newTLSDetails(state *tls.ConnectionState) *TLSDetails {
+	if state == nil {
+		return nil
+	}
+	details := &TLSDetails{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+	}
+	if len(state.PeerCertificates) > 0 {
+		details.PeerCertificateExpiry = state.PeerCertificates[0].NotAfter
+	}
+	return details
+}
+
+// diagnose opens a dedicated connection and collects the server version, the round-trip latency,
+// the negotiated TLS/SSL session, whether the proxy and the SSH tunnel carried it and whether tables() is readable
+func diagnose(ctx context.Context, connector driver.Connector, details *HealthDetails) error {
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	trace := &dialTrace{}
+	conn, err := db.Conn(withDialTrace(ctx, trace))
+	details.Proxy, details.SshTunnel = trace.route()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	if err := conn.PingContext(ctx); err != nil {
+		return err
+	}
+	details.Latency = float64(time.Since(start).Microseconds()) / 1000
+
+	if err := conn.QueryRowContext(ctx, "SELECT build()").Scan(&details.Version); err != nil {
+		log.DefaultLogger.Debug("QuestDB build information is not available", "error", err)
+		if err := conn.QueryRowContext(ctx, "SELECT version()").Scan(&details.Version); err != nil {
+			return err
+		}
+	}
+
+	details.TLS = newTLSDetails(trace.tlsState())
+
+	details.Tables = &TablesDetails{}
+	if err := conn.QueryRowContext(ctx, "SELECT count(*) FROM tables()").Scan(&details.Tables.Count); err != nil {
+		details.Tables.Error = err.Error()
+	} else {
+		details.Tables.Readable = true
+	}
+	return nil
+}
@@ -0,0 +1,470 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	transportPgWire = "pgwire"
+	transportHTTP   = "http"
+)
+
+var errHttpArguments = errors.New("bind parameters are not supported by the QuestDB HTTP transport")
+
+func (settings *Settings) validateTransport() (errs SettingsErrors) {
+	switch settings.Transport {
+	case "", transportPgWire:
+	case transportHTTP:
+		// every statement is a separate request, there is no session to configure
+		if len(settings.CustomSettings) > 0 || len(settings.InitStatements) > 0 {
+			errs.add("transport", ErrorMessageHttpSession)
+		}
+	default:
+		errs.add("transport", ErrorMessageInvalidTransport)
+	}
+	return errs
+}
+
+// httpColumnType - PostgreSQL type name a QuestDB column type is reported as, so that the converters apply to the
+// columns returned by the HTTP transport as they do to those returned over PGWire, and the type it is scanned into
+type httpColumnType struct {
+	name     string
+	scanType reflect.Type
+}
+
+var (
+	httpBoolType      = httpColumnType{"BOOL", reflect.TypeOf(false)}
+	httpInt2Type      = httpColumnType{"INT2", reflect.TypeOf(int16(0))}
+	httpInt4Type      = httpColumnType{"INT4", reflect.TypeOf(int32(0))}
+	httpInt8Type      = httpColumnType{"INT8", reflect.TypeOf(int64(0))}
+	httpFloat4Type    = httpColumnType{"FLOAT4", reflect.TypeOf(float32(0))}
+	httpFloat8Type    = httpColumnType{"FLOAT8", reflect.TypeOf(float64(0))}
+	httpTimestampType = httpColumnType{"TIMESTAMP", reflect.TypeOf(time.Time{})}
+	httpVarcharType   = httpColumnType{"VARCHAR", reflect.TypeOf("")}
+
+	// httpColumnTypes - the QuestDB column types as reported by QuestDB over PGWire, the others are read as strings
+	httpColumnTypes = map[string]httpColumnType{
+		"BOOLEAN":      httpBoolType,
+		"BYTE":         httpInt2Type,
+		"SHORT":        httpInt2Type,
+		"INT":          httpInt4Type,
+		"LONG":         httpInt8Type,
+		"FLOAT":        httpFloat4Type,
+		"DOUBLE":       httpFloat8Type,
+		"DATE":         httpTimestampType,
+		"TIMESTAMP":    httpTimestampType,
+		"TIMESTAMP_NS": {"TIMESTAMP_NS", reflect.TypeOf(time.Time{})},
+	}
+)
+
+func httpColumnTypeOf(questdbType string) httpColumnType {
+	if t, ok := httpColumnTypes[questdbType]; ok {
+		return t
+	}
+	return httpVarcharType
+}
+
+// HttpQueryError - error returned by the /exec endpoint of QuestDB
+type HttpQueryError struct {
+	StatusCode int
+	Message    string
+	// Position is 1-based like the positions of the PostgreSQL errors, 0 when unknown
+	Position int
+}
+
+func (e *HttpQueryError) Error() string {
+	return e.Message
+}
+
+// httpConnector runs the queries with the REST API of QuestDB instead of PGWire. Every query is a single request
+// to the /exec endpoint, whose JSON result is decoded row by row while the frame is built.
+type httpConnector struct {
+	client   *http.Client
+	endpoint string
+	username string
+	password string
+	token    string
+}
+
+// newHttpConnector creates the connector of a single QuestDB host. The connections are made by the given dialer,
+// so that the proxy and the SSH tunnel apply, and TLS/SSL is negotiated by the HTTP client itself.
+func newHttpConnector(settings Settings, host Host, tlsConfig *tls.Config, dialer questdbDialer) *httpConnector {
+	connectTimeout := time.Duration(settings.Timeout) * time.Second
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if connectTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, connectTimeout)
+				defer cancel()
+			}
+			return dialer.DialContext(ctx, network, address)
+		},
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: connectTimeout,
+		MaxIdleConnsPerHost: max(int(settings.MaxIdleConnections), 2),
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	return &httpConnector{
+		client:   &http.Client{Transport: transport},
+		endpoint: (&url.URL{Scheme: scheme, Host: net.JoinHostPort(host.Server, strconv.FormatInt(host.Port, 10)), Path: "/exec"}).String(),
+		username: settings.Username,
+		password: settings.Password,
+		token:    settings.HttpToken,
+	}
+}
+
+// Connect implements driver.Connector. As the server is reached on every query, connecting only checks that it
+// is reachable and accepts the credentials, so that failover and health checks behave as they do with PGWire.
+func (c *httpConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn := &httpConn{connector: c}
+	if err := conn.Ping(ctx); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Driver implements driver.Connector
+func (c *httpConnector) Driver() driver.Driver {
+	return httpDriver{}
+}
+
+// Close releases the idle connections, it is called by sql.DB.Close
+func (c *httpConnector) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// exec sends the query and returns the decoder of the response, positioned in its top level object
+func (c *httpConnector) exec(ctx context.Context, query string) (*json.Decoder, io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"?"+url.Values{"query": {query}, "timings": {"true"}}.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+	// the query is cancelled on the server too when the request times out
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Statement-Timeout", strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 1), 10))
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.TLS != nil {
+		if trace := dialTraceFromContext(ctx); trace != nil {
+			trace.setTLS(*res.TLS)
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, nil, readHttpError(res)
+	}
+
+	decoder := json.NewDecoder(res.Body)
+	decoder.UseNumber()
+	if err := expectDelim(decoder, '{'); err != nil {
+		_ = res.Body.Close()
+		return nil, nil, err
+	}
+	return decoder, res.Body, nil
+}
+
+// readHttpError returns the error of a failed request, QuestDB describes it in a JSON object unless the request
+// did not reach the query engine, e.g. when the credentials are rejected
+func readHttpError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	var message struct {
+		Error    string `json:"error"`
+		Position *int   `json:"position"`
+	}
+	queryErr := &HttpQueryError{StatusCode: res.StatusCode, Message: res.Status}
+	if json.Unmarshal(body, &message) == nil && message.Error != "" {
+		queryErr.Message = message.Error
+		if message.Position != nil {
+			// QuestDB counts the characters from 0
+			queryErr.Position = *message.Position + 1
+		}
+	} else if text := string(body); text != "" && len(text) < 1024 {
+		queryErr.Message = fmt.Sprintf("%s: %s", res.Status, text)
+	}
+	return queryErr
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected QuestDB HTTP response, expected %s got %v", delim, token)
+	}
+	return nil
+}
+
+// httpDriver - the connections of the HTTP transport are only created by the connector
+type httpDriver struct{}
+
+// Open implements driver.Driver
+func (httpDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("the QuestDB HTTP transport requires a connector")
+}
+
+// httpConn - stateless connection of the HTTP transport, the statements are run with the connector
+type httpConn struct {
+	connector *httpConnector
+}
+
+// QueryContext implements driver.QueryerContext
+func (c *httpConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) > 0 {
+		return nil, errHttpArguments
+	}
+	decoder, body, err := c.connector.exec(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rows := &httpRows{decoder: decoder, body: body, trace: queryTraceFromContext(ctx)}
+	if err := rows.readHeader(); err != nil {
+		_ = body.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ExecContext implements driver.ExecerContext
+func (c *httpConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(rows.Columns()))
+	for {
+		if err := rows.Next(dest); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return driver.RowsAffected(rows.(*httpRows).updated), nil
+}
+
+// Ping implements driver.Pinger
+func (c *httpConn) Ping(ctx context.Context) error {
+	_, err := c.ExecContext(ctx, "SELECT 1", nil)
+	return err
+}
+
+// Prepare implements driver.Conn, QuestDB does not prepare the statements sent over HTTP
+func (c *httpConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errHttpArguments
+}
+
+// Begin implements driver.Conn
+func (c *httpConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported by the QuestDB HTTP transport")
+}
+
+// Close implements driver.Conn
+func (c *httpConn) Close() error {
+	return nil
+}
+
+type httpColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// httpRows decodes the rows of the dataset one at a time, the response is not held in memory
+type httpRows struct {
+	decoder *json.Decoder
+	body    io.ReadCloser
+	columns []httpColumn
+	types   []httpColumnType
+	updated int64
+	done    bool
+	trace   *queryTrace
+}
+
+// readHeader reads the response up to the first row. The columns precede the dataset, statements that do not
+// return rows have neither of them.
+func (r *httpRows) readHeader() error {
+	for r.decoder.More() {
+		key, err := r.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "columns":
+			if err := r.decoder.Decode(&r.columns); err != nil {
+				return err
+			}
+			for _, column := range r.columns {
+				r.types = append(r.types, httpColumnTypeOf(column.Type))
+			}
+		case "dataset":
+			return expectDelim(r.decoder, '[')
+		case "updated":
+			if err := r.decoder.Decode(&r.updated); err != nil {
+				return err
+			}
+		default:
+			var skip json.RawMessage
+			if err := r.decoder.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	r.done = true
+	return nil
+}
+
+// readTrailer reads the response after the dataset, the timings of QuestDB and the number of rows follow it
+func (r *httpRows) readTrailer() error {
+	if err := expectDelim(r.decoder, ']'); err != nil {
+		return err
+	}
+	var timings *serverTimings
+	var count int64
+	for r.decoder.More() {
+		key, err := r.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "timings":
+			err = r.decoder.Decode(&timings)
+		case "count":
+			err = r.decoder.Decode(&count)
+		default:
+			var skip json.RawMessage
+			err = r.decoder.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if timings != nil {
+		timings.rows = count
+		r.trace.updateTimings(func(t *queryTimings) {
+			t.server = timings
+		})
+	}
+	return nil
+}
+
+// Columns implements driver.Rows
+func (r *httpRows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, column := range r.columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// Next implements driver.Rows
+func (r *httpRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	if !r.decoder.More() {
+		r.done = true
+		if err := r.readTrailer(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	var row []interface{}
+	if err := r.decoder.Decode(&row); err != nil {
+		return err
+	}
+	if len(row) != len(r.columns) {
+		return fmt.Errorf("unexpected QuestDB HTTP response, expected %d values got %d", len(r.columns), len(row))
+	}
+	for i, value := range row {
+		v, err := httpValue(r.types[i], value)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", r.columns[i].Name, err)
+		}
+		dest[i] = v
+	}
+	return nil
+}
+
+// Close implements driver.Rows
+func (r *httpRows) Close() error {
+	return r.body.Close()
+}
+
+// ColumnTypeDatabaseTypeName implements driver.RowsColumnTypeDatabaseTypeName, used to pick the converters
+func (r *httpRows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.types[index].name
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType
+func (r *httpRows) ColumnTypeScanType(index int) reflect.Type {
+	return r.types[index].scanType
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable, QuestDB does not tell
+func (r *httpRows) ColumnTypeNullable(int) (nullable, ok bool) {
+	return false, false
+}
+
+// httpValue converts a JSON value to the driver value of the column type
+func httpValue(columnType httpColumnType, value interface{}) (driver.Value, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch columnType.scanType.Kind() {
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := value.(json.Number); ok {
+			return n.Int64()
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := value.(json.Number); ok {
+			return n.Float64()
+		}
+	case reflect.Struct:
+		if s, ok := value.(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+	default:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		// arrays and other values without a string representation are kept as JSON
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return nil, fmt.Errorf("unexpected %s value %v", columnType.name, value)
+}
@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"github.com/questdb/grafana-questdb-datasource/pkg/converters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// questdbHttpStandIn answers the /exec requests the way QuestDB does, for the few queries used by the tests
+func questdbHttpStandIn(authorized func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/exec" {
+			http.NotFound(w, r)
+			return
+		}
+		if !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("Unauthorized"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch query := r.URL.Query().Get("query"); query {
+		case "SELECT 1":
+			_, _ = fmt.Fprint(w, `{"query":"SELECT 1","columns":[{"name":"1","type":"INT"}],"timestamp":-1,"dataset":[[1]],"count":1}`)
+		case "SELECT * FROM trades":
+			_, _ = fmt.Fprint(w, `{"query":"SELECT * FROM trades","columns":[`+
+				`{"name":"ts","type":"TIMESTAMP"},{"name":"sym","type":"SYMBOL"},{"name":"price","type":"DOUBLE"},`+
+				`{"name":"qty","type":"LONG"},{"name":"buy","type":"BOOLEAN"},{"name":"venue","type":"SHORT"},`+
+				`{"name":"size","type":"FLOAT"},{"name":"book","type":"DOUBLE[]"}],"timestamp":0,"dataset":[`+
+				`["2024-01-01T10:00:00.000000Z","BTC-USD",42000.5,3,true,1,0.5,[1.0,2.0]],`+
+				`["2024-01-01T10:00:01.123456Z",null,null,null,false,2,null,null]],"count":2,`+
+				`"timings":{"authentication":1000,"compiler":2500000,"execute":1200000,"count":0}}`)
+		case "TRUNCATE TABLE trades":
+			_, _ = fmt.Fprint(w, `{"ddl":"OK"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, `{"query":%q,"error":"table does not exist [table=missing]","position":14}`, query)
+		}
+	})
+}
+
+func httpSettings(t *testing.T, server *httptest.Server) (Settings, Host) {
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.ParseInt(u.Port(), 10, 64)
+	require.NoError(t, err)
+	host := Host{Server: u.Hostname(), Port: port}
+	return Settings{Server: host.Server, Port: host.Port, Username: "admin", Password: "quest", TlsMode: "disable", Transport: transportHTTP}, host
+}
+
+func TestHttpTransport(t *testing.T) {
+	server := httptest.NewServer(questdbHttpStandIn(func(r *http.Request) bool {
+		username, password, ok := r.BasicAuth()
+		return ok && username == "admin" && password == "quest"
+	}))
+	defer server.Close()
+	settings, host := httpSettings(t, server)
+
+	connector, err := newHostConnector(settings, host, "", nil)
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	ctx := context.Background()
+
+	t.Run("should decode the columns with the converters", func(t *testing.T) {
+		trace := &queryTrace{}
+		rows, err := db.QueryContext(withQueryTrace(ctx, trace), "SELECT * FROM trades")
+		require.NoError(t, err)
+		defer rows.Close()
+		frame, err := sqlutil.FrameFromRows(rows, -1, converters.QdbConverters...)
+		require.NoError(t, err)
+		require.Equal(t, 2, frame.Rows())
+
+		types := map[string]data.FieldType{}
+		for _, field := range frame.Fields {
+			types[field.Name] = field.Type()
+		}
+		assert.Equal(t, map[string]data.FieldType{
+			"ts":    data.FieldTypeNullableTime,
+			"sym":   data.FieldTypeNullableString,
+			"price": data.FieldTypeNullableFloat64,
+			"qty":   data.FieldTypeNullableInt64,
+			"buy":   data.FieldTypeBool,
+			"venue": data.FieldTypeInt16,
+			"size":  data.FieldTypeNullableFloat32,
+			"book":  data.FieldTypeNullableString,
+		}, types)
+
+		ts, _ := frame.Fields[0].ConcreteAt(1)
+		assert.Equal(t, time.Date(2024, 1, 1, 10, 0, 1, 123456000, time.UTC), ts)
+		price, _ := frame.Fields[2].ConcreteAt(0)
+		assert.Equal(t, 42000.5, price)
+		_, ok := frame.Fields[2].ConcreteAt(1)
+		assert.False(t, ok)
+		book, _ := frame.Fields[7].ConcreteAt(0)
+		assert.Equal(t, "[1.0,2.0]", book)
+
+		timings := trace.queryTimings()
+		require.NotNil(t, timings.server)
+		assert.Equal(t, serverTimings{Compiler: 2500000, Execute: 1200000, rows: 2}, *timings.server)
+	})
+
+	t.Run("should run statements without rows", func(t *testing.T) {
+		_, err := db.ExecContext(ctx, "TRUNCATE TABLE trades")
+		assert.NoError(t, err)
+	})
+
+	t.Run("should report the error position of the query", func(t *testing.T) {
+		_, err := db.QueryContext(ctx, "SELECT * FROM missing")
+		require.Error(t, err)
+		queryErr := classifyError(err)
+		assert.Equal(t, QueryErrorTableNotFound, queryErr.Kind)
+		assert.Equal(t, 15, queryErr.Position)
+		queryErr.locate("SELECT * FROM missing")
+		assert.Equal(t, 15, queryErr.Column)
+	})
+
+	t.Run("should not bind parameters", func(t *testing.T) {
+		_, err := db.QueryContext(ctx, "SELECT * FROM trades WHERE sym = $1", "BTC-USD")
+		assert.ErrorIs(t, err, errHttpArguments)
+	})
+
+	t.Run("should reject invalid credentials on connect", func(t *testing.T) {
+		settings := settings
+		settings.Password = "wrong"
+		connector, err := newHostConnector(settings, host, "", nil)
+		require.NoError(t, err)
+		_, err = connector.Connect(ctx)
+		require.Error(t, err)
+		assert.Equal(t, QueryErrorPermission, classifyError(err).Kind)
+		assert.False(t, isConnectionError(err))
+	})
+}
+
+func TestHttpTransportToken(t *testing.T) {
+	server := httptest.NewTLSServer(questdbHttpStandIn(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer secret"
+	}))
+	defer server.Close()
+	settings, host := httpSettings(t, server)
+	settings.Username, settings.Password = "", ""
+	settings.HttpToken = "secret"
+	settings.TlsMode = "require"
+
+	connector, err := newHostConnector(settings, host, "", nil)
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	trace := &dialTrace{}
+	conn, err := db.Conn(withDialTrace(context.Background(), trace))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NotNil(t, trace.tlsState())
+
+	var one int32
+	require.NoError(t, conn.QueryRowContext(context.Background(), "SELECT 1").Scan(&one))
+	assert.Equal(t, int32(1), one)
+
+	t.Run("should not connect without TLS", func(t *testing.T) {
+		settings := settings
+		settings.TlsMode = "disable"
+		connector, err := newHostConnector(settings, host, "", nil)
+		require.NoError(t, err)
+		_, err = connector.Connect(context.Background())
+		assert.Error(t, err)
+	})
+}
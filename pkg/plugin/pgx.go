@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	driverPq  = "pq"
+	driverPgx = "pgx"
+
+	// cancelDeadlineDelay is how long a cancelled query may take to stop after the cancel request, before the connection is dropped
+	cancelDeadlineDelay = 5 * time.Second
+)
+
+// newPgxConnector creates a pgx connector, which decodes numerics and timestamps from the binary wire format
+// and cancels running queries with a cancel request when the context is done.
+// Like pq, it dials through the given dialer, which negotiates TLS/SSL and resolves the host name itself.
+func newPgxConnector(connStr string, dialer questdbDialer) (driver.Connector, error) {
+	config, err := pgx.ParseConfig(connStr)
+	if err != nil {
+		log.DefaultLogger.Error("QuestDB pgx configuration failed", "error", err)
+		return nil, fmt.Errorf("QuestDB connector creation failed")
+	}
+
+	config.TLSConfig = nil
+	config.Fallbacks = nil
+	// the host name is resolved by the dialer, or by the proxy as it may not be resolvable from the Grafana server
+	config.LookupFunc = func(_ context.Context, host string) ([]string, error) {
+		return []string{host}, nil
+	}
+	config.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	config.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{Conn: conn, DeadlineDelay: cancelDeadlineDelay}
+	}
+
+	return stdlib.GetConnector(*config), nil
+}
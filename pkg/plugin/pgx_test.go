@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDialer fails every dial and remembers the dialed addresses
+type recordingDialer struct {
+	addresses []string
+}
+
+func (d *recordingDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d *recordingDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	d.addresses = append(d.addresses, address)
+	return nil, errors.New("proxy unavailable")
+}
+
+func TestPgxConnector(t *testing.T) {
+	settings := Settings{Server: "localhost", Port: 8812, Username: "admin", Password: "quest", TlsMode: "disable", Driver: driverPgx}
+
+	t.Run("should create a pgx connector", func(t *testing.T) {
+		connector, err := NewConnector(settings, "version")
+		require.NoError(t, err)
+		assert.IsType(t, &stdlib.Driver{}, connector.Driver())
+	})
+
+	t.Run("should dial through the proxy", func(t *testing.T) {
+		dialer := &recordingDialer{}
+		connector, err := newHostConnector(settings, Host{Server: "questdb.internal", Port: 8812}, "version", dialer)
+		require.NoError(t, err)
+		_, err = connector.Connect(context.Background())
+		assert.ErrorContains(t, err, "proxy unavailable")
+		assert.Equal(t, []string{"questdb.internal:8812"}, dialer.addresses)
+	})
+
+	t.Run("should not fall back to plain text when the server does not support TLS", func(t *testing.T) {
+		pki := newTestPKI(t, "localhost")
+		address := startSSLServer(t, 'N', pki.server)
+		host, port, _ := net.SplitHostPort(address)
+		s := settings
+		s.Server = host
+		s.Port, _ = strconv.ParseInt(port, 10, 64)
+		s.TlsMode = "require"
+		connector, err := NewConnector(s, "version")
+		require.NoError(t, err)
+		_, err = connector.Connect(context.Background())
+		assert.ErrorIs(t, err, ErrorMessageTlsNotSupported)
+	})
+}
@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/questdb/grafana-questdb-datasource/pkg/macros"
+)
+
+var (
+	// timeMacros matches the time macros without column type: $__timeFilter(column), $__fromTime and $__toTime
+	timeMacros = regexp.MustCompile(`\$__timeFilter\(\s*([^,()]+?)\s*\)|\$__(fromTime|toTime)\b(\()?`)
+	// timeColumnPattern matches the column compared to a time macro, at the end of the SQL preceding it
+	timeColumnPattern = regexp.MustCompile(`(?i)((?:"?\w+"?\.)?"?\w+"?)\s*(?:[<>]=?|=|!=|<>|between(?:\s+\S+\s+and)?)\s*$`)
+	// tableReference matches the tables read by the query
+	tableReference = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+"?([^\s"(),;]+)"?`)
+	// tableAlias matches the alias following a table
+	tableAlias = regexp.MustCompile(`(?i)^\s+(?:AS\s+)?"?(\w+)"?`)
+)
+
+// aliasKeywords are the keywords that may follow a table, and are not its alias
+var aliasKeywords = map[string]bool{
+	"where": true, "join": true, "inner": true, "left": true, "right": true, "full": true, "outer": true, "cross": true,
+	"asof": true, "lt": true, "splice": true, "on": true, "sample": true, "latest": true, "order": true, "group": true,
+	"limit": true, "union": true, "except": true, "intersect": true, "timestamp": true, "with": true,
+}
+
+// queryTable - table read by a query, under its alias when it has one
+type queryTable struct {
+	name  string
+	alias string
+}
+
+// sqlTables returns the tables the SQL reads from, in order
+func sqlTables(sql string) []queryTable {
+	var tables []queryTable
+	for _, match := range tableReference.FindAllStringSubmatchIndex(sql, -1) {
+		table := queryTable{name: sql[match[2]:match[3]]}
+		if alias := tableAlias.FindStringSubmatch(sql[match[1]:]); alias != nil && !aliasKeywords[strings.ToLower(alias[1])] {
+			table.alias = alias[1]
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// timeColumns resolves the columns of the tables of a query, the columns of tables that can't be looked up are unknown
+type timeColumns struct {
+	ctx     context.Context
+	schema  *schemaResources
+	tables  []queryTable
+	columns map[string][]SchemaColumn
+}
+
+func newTimeColumns(ctx context.Context, schema *schemaResources, sql string) *timeColumns {
+	return &timeColumns{ctx: ctx, schema: schema, tables: sqlTables(sql), columns: map[string][]SchemaColumn{}}
+}
+
+func (c *timeColumns) of(table string) []SchemaColumn {
+	if columns, ok := c.columns[table]; ok {
+		return columns
+	}
+	columns, err := c.schema.tableColumns(c.ctx, table)
+	if err != nil {
+		log.DefaultLogger.Debug("QuestDB time macros are cast to timestamp, the columns of the table are unknown", "table", table, "error", err)
+	}
+	c.columns[table] = columns
+	return columns
+}
+
+// typeOf returns the type of the column, qualified by a table or an alias, or else of the first table having it
+func (c *timeColumns) typeOf(column string) (string, bool) {
+	column = strings.ReplaceAll(column, `"`, "")
+	if qualifier, name, ok := strings.Cut(column, "."); ok {
+		for _, table := range c.tables {
+			if strings.EqualFold(table.alias, qualifier) || strings.EqualFold(table.name, qualifier) {
+				return columnTypeOf(c.of(table.name), name)
+			}
+		}
+		return "", false
+	}
+	for _, table := range c.tables {
+		if columnType, ok := columnTypeOf(c.of(table.name), column); ok {
+			return columnType, true
+		}
+	}
+	return "", false
+}
+
+// designated returns the type of the designated timestamp of the first table
+func (c *timeColumns) designated() string {
+	if len(c.tables) == 0 {
+		return ""
+	}
+	for _, column := range c.of(c.tables[0].name) {
+		if column.Designated {
+			return strings.ToLower(column.Type)
+		}
+	}
+	return ""
+}
+
+// setTimePrecision gives the time macros of the rawSql the type of the TIMESTAMP_NS columns they filter, so that
+// they are replaced by nanosecond timestamps. The column of $__timeFilter is its argument, the column of $__fromTime
+// and $__toTime is the one they are compared to, or else the designated timestamp of the first table. Columns
+// qualified by a table or an alias are looked up in that table, the others in the first table having them.
+// The macros with an explicit type, or filtering columns of unknown tables, keep the microsecond timestamps.
+func setTimePrecision(ctx context.Context, query json.RawMessage, schema *schemaResources) (json.RawMessage, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(query, &fields); err != nil {
+		return query, false, err
+	}
+	var rawSQL string
+	if err := json.Unmarshal(fields["rawSql"], &rawSQL); err != nil || schema == nil || !timeMacros.MatchString(rawSQL) {
+		return query, false, nil
+	}
+	columns := newTimeColumns(ctx, schema, rawSQL)
+
+	var sql strings.Builder
+	last := 0
+	for _, m := range timeMacros.FindAllStringSubmatchIndex(rawSQL, -1) {
+		sql.WriteString(rawSQL[last:m[0]])
+		last = m[1]
+		text := rawSQL[m[0]:m[1]]
+		switch {
+		case m[2] >= 0:
+			if columnType, ok := columns.typeOf(rawSQL[m[2]:m[3]]); ok && columnType == macros.TimestampNs {
+				text = "$__timeFilter(" + rawSQL[m[2]:m[3]] + ", " + macros.TimestampNs + ")"
+			}
+		case m[6] < 0:
+			columnType, ok := "", false
+			if c := timeColumnPattern.FindStringSubmatch(rawSQL[:m[0]]); c != nil {
+				columnType, ok = columns.typeOf(c[1])
+			}
+			if !ok {
+				columnType = columns.designated()
+			}
+			if columnType == macros.TimestampNs {
+				text = "$__" + rawSQL[m[4]:m[5]] + "(" + macros.TimestampNs + ")"
+			}
+		}
+		sql.WriteString(text)
+	}
+	sql.WriteString(rawSQL[last:])
+	if sql.String() == rawSQL {
+		return query, false, nil
+	}
+
+	fields["rawSql"], _ = json.Marshal(sql.String())
+	mutated, err := json.Marshal(fields)
+	if err != nil {
+		return query, false, err
+	}
+	return mutated, true, nil
+}
+
+// timeColumnType returns the type of the time column of the tables the SQL reads from, timestamp when it is unknown
+func timeColumnType(ctx context.Context, schema *schemaResources, sql, column string) string {
+	if schema == nil {
+		return "timestamp"
+	}
+	if columnType, ok := newTimeColumns(ctx, schema, sql).typeOf(column); ok && columnType == macros.TimestampNs {
+		return columnType
+	}
+	return "timestamp"
+}
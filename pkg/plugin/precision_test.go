@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTimePrecision(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch query := r.URL.Query().Get("query"); {
+		case query == "SELECT 1":
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"1","type":"INT"}],"dataset":[[1]]}`)
+		case strings.Contains(query, "FROM table_columns('ticks')"):
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"column","type":"STRING"},{"name":"type","type":"STRING"},{"name":"designated","type":"BOOLEAN"}],`+
+				`"dataset":[["ts","TIMESTAMP_NS",true],["received","TIMESTAMP",false],["price","DOUBLE",false]]}`)
+		case strings.Contains(query, "FROM table_columns('trades')"):
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"column","type":"STRING"},{"name":"type","type":"STRING"},{"name":"designated","type":"BOOLEAN"}],`+
+				`"dataset":[["ts","TIMESTAMP",true],["settled","TIMESTAMP_NS",false]]}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"table does not exist [table=missing]","position":0}`)
+		}
+	}))
+	defer server.Close()
+	settings, host := httpSettings(t, server)
+	connector, err := newHostConnector(settings, host, "", nil)
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	h := &QuestDB{schema: newSchemaResources(time.Minute, func(context.Context) (*sql.DB, error) { return db, nil })}
+
+	tests := []struct {
+		name   string
+		rawSQL string
+		want   string
+	}{
+		{name: "should type the time filter of a nanosecond column", rawSQL: `SELECT * FROM ticks WHERE $__timeFilter("ts")`,
+			want: `SELECT * FROM ticks WHERE $__timeFilter("ts", timestamp_ns)`},
+		{name: "should keep the time filter of a microsecond column", rawSQL: `SELECT * FROM ticks WHERE $__timeFilter(received)`,
+			want: `SELECT * FROM ticks WHERE $__timeFilter(received)`},
+		{name: "should type the times compared to nanosecond columns", rawSQL: `SELECT * FROM trades WHERE ts >= $__fromTime AND settled BETWEEN $__fromTime AND $__toTime`,
+			want: `SELECT * FROM trades WHERE ts >= $__fromTime AND settled BETWEEN $__fromTime(timestamp_ns) AND $__toTime(timestamp_ns)`},
+		{name: "should type the times after the designated timestamp", rawSQL: `SELECT dateadd('d', -1, $__toTime) FROM ticks`,
+			want: `SELECT dateadd('d', -1, $__toTime(timestamp_ns)) FROM ticks`},
+		{name: "should keep the explicit types", rawSQL: `SELECT * FROM ticks WHERE $__timeFilter(ts, timestamp) AND ts < $__toTime(timestamp)`,
+			want: `SELECT * FROM ticks WHERE $__timeFilter(ts, timestamp) AND ts < $__toTime(timestamp)`},
+		{name: "should type the time filter of an aliased joined table", rawSQL: `SELECT * FROM trades t ASOF JOIN ticks AS k WHERE $__timeFilter(k.ts) AND t.ts < $__toTime`,
+			want: `SELECT * FROM trades t ASOF JOIN ticks AS k WHERE $__timeFilter(k.ts, timestamp_ns) AND t.ts < $__toTime`},
+		{name: "should type the times compared to a column qualified by its table", rawSQL: `SELECT * FROM trades JOIN ticks ON trades.ts = ticks.received WHERE "ticks"."ts" > $__fromTime`,
+			want: `SELECT * FROM trades JOIN ticks ON trades.ts = ticks.received WHERE "ticks"."ts" > $__fromTime(timestamp_ns)`},
+		{name: "should type the columns of the first table having them", rawSQL: `SELECT * FROM (SELECT * FROM trades JOIN ticks ON trades.ts = ticks.ts) WHERE $__timeFilter(received)`,
+			want: `SELECT * FROM (SELECT * FROM trades JOIN ticks ON trades.ts = ticks.ts) WHERE $__timeFilter(received)`},
+		{name: "should type the columns of subqueries", rawSQL: `SELECT * FROM (SELECT * FROM trades) WHERE $__timeFilter(settled)`,
+			want: `SELECT * FROM (SELECT * FROM trades) WHERE $__timeFilter(settled, timestamp_ns)`},
+		{name: "should keep the macros of unknown qualifiers", rawSQL: `SELECT * FROM ticks WHERE $__timeFilter(x.ts)`,
+			want: `SELECT * FROM ticks WHERE $__timeFilter(x.ts)`},
+		{name: "should keep the macros of unknown tables", rawSQL: `SELECT * FROM missing WHERE $__timeFilter(ts)`,
+			want: `SELECT * FROM missing WHERE $__timeFilter(ts)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := fmt.Sprintf(`{"rawSql":%q}`, tt.rawSQL)
+			_, q := h.MutateQuery(context.Background(), backend.DataQuery{JSON: json.RawMessage(query)})
+			var mutated struct {
+				RawSQL string `json:"rawSql"`
+			}
+			require.NoError(t, json.Unmarshal(q.JSON, &mutated))
+			assert.Equal(t, tt.want, mutated.RawSQL)
+		})
+	}
+
+	t.Run("should type the time columns of the streams", func(t *testing.T) {
+		assert.Equal(t, "timestamp_ns", timeColumnType(context.Background(), h.schema, `SELECT * FROM ticks`, "ts"))
+		assert.Equal(t, "timestamp", timeColumnType(context.Background(), h.schema, `SELECT * FROM ticks`, "received"))
+		assert.Equal(t, "timestamp", timeColumnType(context.Background(), h.schema, `SELECT * FROM missing`, "ts"))
+		assert.Equal(t, "timestamp_ns", timeColumnType(context.Background(), h.schema, `SELECT * FROM trades JOIN ticks k ON trades.ts = k.ts`, "k.ts"))
+	})
+}
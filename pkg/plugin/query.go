@@ -0,0 +1,377 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	cancelReasonTimeout   = "timeout"
+	cancelReasonCancelled = "cancelled"
+)
+
+var cancellationsMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "plugins",
+	Name:      "questdb_query_cancellations_total",
+	Help:      "Number of QuestDB queries cancelled on the server because the request was cancelled or timed out",
+}, []string{"datasource_uid", "pool", "reason"})
+
+// queryTrace records what happened to the statements run for a single query, the connections fill it in when it
+// is found in the context. sqlds turns the errors into messages, the trace keeps the error returned by the driver.
+type queryTrace struct {
+	mu      sync.Mutex
+	query   string
+	err     error
+	timings queryTimings
+	notices []string
+}
+
+type queryTraceKey struct{}
+
+func withQueryTrace(ctx context.Context, trace *queryTrace) context.Context {
+	return context.WithValue(ctx, queryTraceKey{}, trace)
+}
+
+func queryTraceFromContext(ctx context.Context) *queryTrace {
+	trace, _ := ctx.Value(queryTraceKey{}).(*queryTrace)
+	return trace
+}
+
+// setError records the error of the driver, a nil trace is ignored
+func (t *queryTrace) setError(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+// setQuery records the SQL sent to QuestDB, a nil trace is ignored
+func (t *queryTrace) setQuery(query string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.query = query
+}
+
+// addNotice records a warning to show with the results of the query, a nil trace is ignored
+func (t *queryTrace) addNotice(text string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notices = append(t.notices, text)
+}
+
+func (t *queryTrace) queryNotices() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.notices
+}
+
+func (t *queryTrace) executedQuery() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.query
+}
+
+func (t *queryTrace) error() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// queryConnector observes the queries run on the connections of a pool.
+// Both drivers send a cancel request to QuestDB when the context of a query is done (pq natively, pgx through
+// its CancelRequestContextWatcherHandler), so that the server stops the query instead of burning CPU for nothing.
+// Every such cancellation is logged and counted.
+type queryConnector struct {
+	driver.Connector
+	datasourceUID string
+	pool          string
+}
+
+// Connect implements driver.Connector
+func (c *queryConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		queryTraceFromContext(ctx).setError(err)
+		return nil, err
+	}
+	return &queryConn{Conn: conn, connector: c}, nil
+}
+
+// Close closes the underlying connector, see sql.DB.Close
+func (c *queryConnector) Close() error {
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// cancelled logs and counts a query that was cancelled because its context is done
+func (c *queryConnector) cancelled(ctx context.Context, query string, start time.Time) {
+	reason := cancelReasonCancelled
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		reason = cancelReasonTimeout
+	}
+	log.DefaultLogger.Info("QuestDB query cancelled", "reason", reason, "pool", c.pool, "duration", time.Since(start), "query", query)
+	cancellationsMetric.WithLabelValues(c.datasourceUID, c.pool, reason).Inc()
+}
+
+// query runs a query, records it in the trace and reports its cancellation. The rows report the errors and
+// the cancellations while they are read.
+func (c *queryConnector) query(ctx context.Context, query string, run func() (driver.Rows, error)) (driver.Rows, error) {
+	queryTraceFromContext(ctx).setQuery(query)
+	start := time.Now()
+	rows, err := run()
+	if err != nil {
+		queryTraceFromContext(ctx).setError(err)
+		if ctx.Err() != nil {
+			c.cancelled(ctx, query, start)
+		}
+		return nil, err
+	}
+	response := time.Since(start)
+	queryTraceFromContext(ctx).updateTimings(func(timings *queryTimings) {
+		timings.response = response
+	})
+	return &queryRows{Rows: rows, ctx: ctx, query: query, start: start, fetchStart: time.Now(), connector: c}, nil
+}
+
+// exec runs a statement and reports its cancellation
+func (c *queryConnector) exec(ctx context.Context, query string, run func() (driver.Result, error)) (driver.Result, error) {
+	start := time.Now()
+	result, err := run()
+	if err != nil && ctx.Err() != nil {
+		c.cancelled(ctx, query, start)
+	}
+	return result, err
+}
+
+// queryConn forwards everything to the driver connection and reports the queries interrupted by their context
+type queryConn struct {
+	driver.Conn
+	connector *queryConnector
+}
+
+// QueryContext implements driver.QueryerContext
+func (c *queryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return c.connector.query(ctx, query, func() (driver.Rows, error) {
+		return queryer.QueryContext(ctx, query, args)
+	})
+}
+
+// ExecContext implements driver.ExecerContext
+func (c *queryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return c.connector.exec(ctx, query, func() (driver.Result, error) {
+		return execer.ExecContext(ctx, query, args)
+	})
+}
+
+// PrepareContext implements driver.ConnPrepareContext, the queries of the statement are reported like the others
+func (c *queryConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &queryStmt{Stmt: stmt, conn: c, query: query}, nil
+}
+
+// BeginTx implements driver.ConnBeginTx
+func (c *queryConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() //nolint:staticcheck
+}
+
+// Ping implements driver.Pinger
+func (c *queryConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession implements driver.SessionResetter
+func (c *queryConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator
+func (c *queryConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue implements driver.NamedValueChecker, so that pgx converts the arguments itself
+func (c *queryConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// queryStmt - prepared statement of a queryConn, its queries are reported like the ones of the connection
+type queryStmt struct {
+	driver.Stmt
+	conn  *queryConn
+	query string
+}
+
+// QueryContext implements driver.StmtQueryContext
+func (s *queryStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.connector.query(ctx, s.query, func() (driver.Rows, error) {
+		if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+			return queryer.QueryContext(ctx, args)
+		}
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Stmt.Query(values) //nolint:staticcheck
+	})
+}
+
+// ExecContext implements driver.StmtExecContext
+func (s *queryStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.connector.exec(ctx, s.query, func() (driver.Result, error) {
+		if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+			return execer.ExecContext(ctx, args)
+		}
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Stmt.Exec(values) //nolint:staticcheck
+	})
+}
+
+// CheckNamedValue implements driver.NamedValueChecker, the statement takes over the checker of the connection
+func (s *queryStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return s.conn.CheckNamedValue(value)
+}
+
+// namedValuesToValues returns the values of the statements that don't support named arguments
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("named argument %s is not supported", arg.Name)
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// queryRows reports the errors and the queries cancelled while their rows are read, which is where most of the time is spent
+type queryRows struct {
+	driver.Rows
+	ctx        context.Context
+	query      string
+	start      time.Time
+	fetchStart time.Time
+	rows       int64
+	connector  *queryConnector
+	once       sync.Once
+}
+
+// Next implements driver.Rows
+func (r *queryRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.rows++
+		return nil
+	}
+	if err == io.EOF {
+		fetch := time.Since(r.fetchStart)
+		queryTraceFromContext(r.ctx).updateTimings(func(timings *queryTimings) {
+			timings.fetch, timings.rows = fetch, r.rows
+		})
+		return err
+	}
+	queryTraceFromContext(r.ctx).setError(err)
+	if r.ctx.Err() != nil {
+		r.once.Do(func() {
+			r.connector.cancelled(r.ctx, r.query, r.start)
+		})
+	}
+	return err
+}
+
+// ColumnTypeDatabaseTypeName implements driver.RowsColumnTypeDatabaseTypeName, used to pick the converters
+func (r *queryRows) ColumnTypeDatabaseTypeName(index int) string {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return rows.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType
+func (r *queryRows) ColumnTypeScanType(index int) reflect.Type {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return rows.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable
+func (r *queryRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return rows.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+// ColumnTypeLength implements driver.RowsColumnTypeLength
+func (r *queryRows) ColumnTypeLength(index int) (length int64, ok bool) {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return rows.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+// ColumnTypePrecisionScale implements driver.RowsColumnTypePrecisionScale
+func (r *queryRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if rows, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return rows.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
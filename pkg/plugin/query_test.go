@@ -0,0 +1,150 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowConn answers queries with rows that block until the context of the query is done
+type slowConn struct {
+	fakeConn
+	rows int
+}
+
+func (c *slowConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	if c.rows < 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &slowRows{ctx: ctx, rows: c.rows}, nil
+}
+
+func (c *slowConn) Prepare(_ string) (driver.Stmt, error) { return &slowStmt{conn: c}, nil }
+
+// slowStmt - prepared statement of a slowConn
+type slowStmt struct {
+	conn *slowConn
+}
+
+func (s *slowStmt) Close() error { return nil }
+
+func (s *slowStmt) NumInput() int { return -1 }
+
+func (s *slowStmt) Exec(_ []driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+
+func (s *slowStmt) Query(_ []driver.Value) (driver.Rows, error) { return nil, driver.ErrSkip }
+
+func (s *slowStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, "", args)
+}
+
+type slowRows struct {
+	ctx  context.Context
+	rows int
+}
+
+func (r *slowRows) Columns() []string { return []string{"x"} }
+
+func (r *slowRows) Close() error { return nil }
+
+func (r *slowRows) Next(dest []driver.Value) error {
+	if r.rows == 0 {
+		return io.EOF
+	}
+	if r.rows > 1000 {
+		<-r.ctx.Done()
+		return r.ctx.Err()
+	}
+	r.rows--
+	dest[0] = int64(r.rows)
+	return nil
+}
+
+func (r *slowRows) ColumnTypeDatabaseTypeName(_ int) string { return "INT8" }
+
+type slowConnector struct {
+	conn *slowConn
+}
+
+func (c *slowConnector) Connect(_ context.Context) (driver.Conn, error) { return c.conn, nil }
+
+func (c *slowConnector) Driver() driver.Driver { return nil }
+
+func TestQueryCancellation(t *testing.T) {
+	cancellations := func(reason string) float64 {
+		return testutil.ToFloat64(cancellationsMetric.WithLabelValues("ds-uid", "default", reason))
+	}
+	open := func(rows int) *sql.DB {
+		return sql.OpenDB(&queryConnector{Connector: &slowConnector{conn: &slowConn{rows: rows}}, datasourceUID: "ds-uid", pool: "default"})
+	}
+
+	t.Run("should not count completed queries", func(t *testing.T) {
+		db := open(3)
+		defer db.Close()
+		before := cancellations(cancelReasonCancelled)
+		rows, err := db.QueryContext(context.Background(), "SELECT x FROM long_sequence(3)")
+		require.NoError(t, err)
+		types, err := rows.ColumnTypes()
+		require.NoError(t, err)
+		assert.Equal(t, "INT8", types[0].DatabaseTypeName())
+		count := 0
+		for rows.Next() {
+			count++
+		}
+		require.NoError(t, rows.Err())
+		assert.Equal(t, 3, count)
+		assert.Equal(t, before, cancellations(cancelReasonCancelled))
+	})
+
+	t.Run("should count queries that time out", func(t *testing.T) {
+		db := open(-1)
+		defer db.Close()
+		before := cancellations(cancelReasonTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := db.QueryContext(ctx, "SELECT sleep(1000)")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, before+1, cancellations(cancelReasonTimeout))
+	})
+
+	t.Run("should count queries cancelled while reading rows", func(t *testing.T) {
+		db := open(5000)
+		defer db.Close()
+		before := cancellations(cancelReasonCancelled)
+		ctx, cancel := context.WithCancel(context.Background())
+		rows, err := db.QueryContext(ctx, "SELECT x FROM long_sequence(5000)")
+		require.NoError(t, err)
+		time.AfterFunc(20*time.Millisecond, cancel)
+		for rows.Next() {
+		}
+		assert.Error(t, rows.Err())
+		assert.Equal(t, before+1, cancellations(cancelReasonCancelled))
+	})
+
+	t.Run("should trace and count the queries of prepared statements", func(t *testing.T) {
+		db := open(5000)
+		defer db.Close()
+		before := cancellations(cancelReasonCancelled)
+		trace := &queryTrace{}
+		ctx, cancel := context.WithCancel(withQueryTrace(context.Background(), trace))
+		stmt, err := db.PrepareContext(ctx, "SELECT x FROM long_sequence(5000)")
+		require.NoError(t, err)
+		defer stmt.Close()
+		rows, err := stmt.QueryContext(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT x FROM long_sequence(5000)", trace.executedQuery())
+		cancel()
+		for rows.Next() {
+		}
+		assert.Error(t, rows.Err())
+		assert.Equal(t, before+1, cancellations(cancelReasonCancelled))
+	})
+}
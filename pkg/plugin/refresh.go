@@ -0,0 +1,183 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/sqlds/v4"
+)
+
+const (
+	// incrementalRefreshTTL is how long the last result of a query is remembered, dashboards refresh far more often
+	incrementalRefreshTTL = 15 * time.Minute
+
+	refreshFull        = "full"
+	refreshIncremental = "incremental"
+)
+
+func (settings *Settings) validateIncrementalRefresh() (errs SettingsErrors) {
+	if settings.IncrementalRefreshOverlap < 0 {
+		errs.add("incrementalRefreshOverlap", ErrorMessageInvalidIncrementalRefresh)
+	}
+	return errs
+}
+
+// newRefreshCache returns the last results of the queries, nil when the incremental refresh is disabled
+func newRefreshCache(settings Settings) *queryCache {
+	if !settings.EnableIncrementalRefresh {
+		return nil
+	}
+	return newFrameCache(incrementalRefreshTTL, settings.cacheMaxMemory())
+}
+
+var (
+	timeFilterPattern        = regexp.MustCompile(`\$__timeFilter\(`)
+	fromTimePattern          = regexp.MustCompile(`\$__fromTime\b`)
+	nonIncrementalSqlPattern = regexp.MustCompile(`(?i)\b(limit|latest\s+on|group\s+by|sample\s+by|distinct)\b|\border\s+by\b.*\bdesc\b`)
+	// aggregatePattern matches the aggregate and window functions, of which a row depends on the rows before the tail
+	aggregatePattern = regexp.MustCompile(`(?i)\b(count|count_distinct|sum|ksum|nsum|avg|min|max|first|last|first_not_null|last_not_null|` +
+		`stddev\w*|variance|var_\w+|covar_\w+|corr|string_agg|string_distinct_agg|approx_\w+|mode|bool_and|bool_or|` +
+		`bit_and|bit_or|bit_xor|weighted_\w+|haversine_dist_deg)\s*\(|\bover\s*\(`)
+)
+
+// incrementalQuery - query of which only the tail is fetched, the rows of the last result before the tail are kept
+type incrementalQuery struct {
+	key      string
+	previous data.Frames
+	tailFrom time.Time
+}
+
+// refreshKeyOf identifies the query of a panel regardless of its time range
+func refreshKeyOf(query backend.DataQuery, pool string) (string, bool) {
+	q, err := sqlds.GetQuery(query, nil, false)
+	if err != nil {
+		return "", false
+	}
+	// the rows must not depend on the start of the time range other than through the time filter. Only the raw rows
+	// qualify: the buckets of SAMPLE BY, or the implicit aggregation of QuestDB, would be fetched again partially
+	if !timeFilterPattern.MatchString(q.RawSQL) || fromTimePattern.MatchString(q.RawSQL) || nonIncrementalSqlPattern.MatchString(q.RawSQL) ||
+		aggregatePattern.MatchString(q.RawSQL) {
+		return "", false
+	}
+	hash := sha256.New()
+	parts := []string{pool, q.RawSQL, strconv.Itoa(int(q.Format)), strconv.FormatInt(int64(query.Interval), 10)}
+	for _, part := range append(parts, queryParameters(query)...) {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// tail returns the query fetching only the rows after the last result, minus the overlap for late data.
+// ok is false when the whole time range must be fetched. Only the mergeable results are stored, see storeTail.
+func (c *queryCache) tail(key string, query backend.DataQuery, overlap time.Duration) (incremental incrementalQuery, tailQuery backend.DataQuery, ok bool) {
+	previous, timeRange, found := c.lookup(key)
+	if !found || query.TimeRange.From.Before(timeRange.From) || query.TimeRange.To.Before(timeRange.To) {
+		return incrementalQuery{}, query, false
+	}
+	tailFrom := timeRange.To.Add(-overlap)
+	if query.Interval > 0 {
+		tailFrom = tailFrom.Truncate(query.Interval)
+	}
+	if !tailFrom.After(query.TimeRange.From) {
+		return incrementalQuery{}, query, false
+	}
+	tailQuery = query
+	tailQuery.TimeRange.From = tailFrom
+	return incrementalQuery{key: key, previous: previous, tailFrom: tailFrom}, tailQuery, true
+}
+
+// mergeable tells whether the tail of a later refresh can be merged into the frames: a single frame with a time field
+// and its rows in ascending time order, the rows of queries ordered otherwise would be misplaced
+func mergeable(frames data.Frames) bool {
+	timeIndex, ok := timeFieldIndex(frames)
+	return ok && ascending(frames[0].Fields[timeIndex])
+}
+
+// timeFieldIndex returns the index of the first time field of a single frame
+func timeFieldIndex(frames data.Frames) (int, bool) {
+	if len(frames) != 1 {
+		return 0, false
+	}
+	for i, field := range frames[0].Fields {
+		if t := field.Type(); t == data.FieldTypeTime || t == data.FieldTypeNullableTime {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// storeTail remembers the result of a query for its next refresh. The results that can't be merged are not stored,
+// so that the next refresh fetches the whole time range at once rather than a tail that would be dropped.
+func (c *queryCache) storeTail(key string, frames data.Frames, timeRange backend.TimeRange) {
+	if !mergeable(frames) {
+		c.delete(key)
+		return
+	}
+	c.store(key, frames, timeRange)
+}
+
+// mergeTail keeps the rows of the previous frame between the start of the time range and the tail, followed by all the
+// rows of the tail. Only mergeable frames with the same fields can be merged.
+func mergeTail(previous, tail data.Frames, from, tailFrom time.Time) (data.Frames, bool) {
+	if len(previous) != 1 || len(tail) != 1 || !sameFields(previous[0], tail[0]) {
+		return nil, false
+	}
+	timeIndex, ok := timeFieldIndex(tail)
+	if !ok {
+		return nil, false
+	}
+
+	merged := tail[0].EmptyCopy()
+	timeField := previous[0].Fields[timeIndex]
+	for i := 0; i < timeField.Len(); i++ {
+		t, ok := timeField.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		if ts := t.(time.Time); !ts.Before(from) && ts.Before(tailFrom) {
+			merged.AppendRow(previous[0].RowCopy(i)...)
+		}
+	}
+	for i := 0; i < tail[0].Rows(); i++ {
+		merged.AppendRow(tail[0].RowCopy(i)...)
+	}
+	if !ascending(merged.Fields[timeIndex]) {
+		return nil, false
+	}
+	return data.Frames{merged}, true
+}
+
+// ascending tells whether the non null times of the field are in ascending order
+func ascending(field *data.Field) bool {
+	var last time.Time
+	for i := 0; i < field.Len(); i++ {
+		t, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		ts := t.(time.Time)
+		if ts.Before(last) {
+			return false
+		}
+		last = ts
+	}
+	return true
+}
+
+func sameFields(a, b *data.Frame) bool {
+	if len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	for i := range a.Fields {
+		if a.Fields[i].Name != b.Fields[i].Name || a.Fields[i].Type() != b.Fields[i].Type() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var refreshStart = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+// newSampledFrame returns a frame with a row per minute from the given minute after the start
+func newSampledFrame(from, count int, value float64) data.Frames {
+	times := make([]time.Time, count)
+	values := make([]float64, count)
+	for i := range times {
+		times[i] = refreshStart.Add(time.Duration(from+i) * time.Minute)
+		values[i] = value
+	}
+	return data.Frames{data.NewFrame("result", data.NewField("ts", nil, times), data.NewField("price", nil, values))}
+}
+
+func newRefreshQuery(sql string, from, to time.Time) backend.DataQuery {
+	return backend.DataQuery{
+		RefID:     "A",
+		Interval:  time.Minute,
+		TimeRange: backend.TimeRange{From: from, To: to},
+		JSON:      []byte(`{"rawSql": "` + sql + `", "format": 0}`),
+	}
+}
+
+func TestRefreshKeyOf(t *testing.T) {
+	sql := "SELECT ts, price FROM trades WHERE $__timeFilter(ts) ORDER BY ts"
+	key, ok := refreshKeyOf(newRefreshQuery(sql, refreshStart, refreshStart.Add(time.Hour)), "")
+	require.True(t, ok)
+
+	// the key does not depend on the time range
+	later, ok := refreshKeyOf(newRefreshQuery(sql, refreshStart.Add(time.Minute), refreshStart.Add(2*time.Hour)), "")
+	require.True(t, ok)
+	assert.Equal(t, key, later)
+
+	alerting, ok := refreshKeyOf(newRefreshQuery(sql, refreshStart, refreshStart.Add(time.Hour)), poolAlerting)
+	require.True(t, ok)
+	assert.NotEqual(t, key, alerting)
+
+	for _, sql := range []string{
+		"SELECT * FROM trades",
+		"SELECT * FROM trades WHERE ts > $__fromTime AND $__timeFilter(ts)",
+		"SELECT * FROM trades WHERE $__timeFilter(ts) LIMIT -10",
+		"SELECT * FROM trades WHERE $__timeFilter(ts) LATEST ON ts PARTITION BY symbol",
+		"SELECT symbol, count() FROM trades WHERE $__timeFilter(ts) GROUP BY symbol",
+		"SELECT * FROM trades WHERE $__timeFilter(ts) ORDER BY ts DESC",
+		"SELECT * FROM trades WHERE $__timeFilter(ts) ORDER BY symbol, ts desc",
+		"SELECT ts, avg(price) FROM trades WHERE $__timeFilter(ts) SAMPLE BY $__sampleByInterval",
+		"SELECT ts, avg(price) FROM trades WHERE $__timeFilter(ts) SAMPLE BY 1h",
+		"SELECT ts, last(price) FROM trades WHERE $__timeFilter(ts) SAMPLE BY 1d $__sampleByAlign",
+		"SELECT symbol, max(ts), count() FROM trades WHERE $__timeFilter(ts)",
+		"SELECT ts, avg(price) OVER (ORDER BY ts ROWS 10 PRECEDING) FROM trades WHERE $__timeFilter(ts)",
+		"SELECT DISTINCT ts FROM trades WHERE $__timeFilter(ts)",
+	} {
+		_, ok := refreshKeyOf(newRefreshQuery(sql, refreshStart, refreshStart.Add(time.Hour)), "")
+		assert.False(t, ok, sql)
+	}
+}
+
+func TestRefreshTail(t *testing.T) {
+	cache := newRefreshCache(Settings{EnableIncrementalRefresh: true})
+	require.NotNil(t, cache)
+	assert.Nil(t, newRefreshCache(Settings{}))
+
+	query := newRefreshQuery("", refreshStart, refreshStart.Add(time.Hour))
+	_, tail, ok := cache.tail("key", query, 0)
+	assert.False(t, ok)
+	assert.Equal(t, query, tail)
+
+	cache.store("key", newSampledFrame(0, 60, 1), query.TimeRange)
+
+	t.Run("should fetch the tail with the overlap from the start of its interval", func(t *testing.T) {
+		next := newRefreshQuery("", refreshStart.Add(5*time.Second), refreshStart.Add(time.Hour+5*time.Second))
+		incremental, tail, ok := cache.tail("key", next, 90*time.Second)
+		require.True(t, ok)
+		assert.Equal(t, refreshStart.Add(58*time.Minute), incremental.tailFrom)
+		assert.Equal(t, refreshStart.Add(58*time.Minute), tail.TimeRange.From)
+		assert.Equal(t, next.TimeRange.To, tail.TimeRange.To)
+		assert.Len(t, incremental.previous, 1)
+	})
+
+	t.Run("should fetch the whole time range when it starts before the last result", func(t *testing.T) {
+		_, _, ok := cache.tail("key", newRefreshQuery("", refreshStart.Add(-time.Minute), refreshStart.Add(time.Hour)), 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("should fetch the whole time range when it ends before the last result", func(t *testing.T) {
+		_, _, ok := cache.tail("key", newRefreshQuery("", refreshStart, refreshStart.Add(30*time.Minute)), 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("should fetch the whole time range when the overlap covers it", func(t *testing.T) {
+		_, _, ok := cache.tail("key", newRefreshQuery("", refreshStart.Add(time.Minute), refreshStart.Add(time.Hour)), 2*time.Hour)
+		assert.False(t, ok)
+	})
+}
+
+func TestMergeTail(t *testing.T) {
+	previous := newSampledFrame(0, 60, 1)
+	tail := newSampledFrame(58, 3, 2)
+	merged, ok := mergeTail(previous, tail, refreshStart.Add(time.Minute), refreshStart.Add(58*time.Minute))
+	require.True(t, ok)
+	require.Len(t, merged, 1)
+
+	// the first row slid out of the time range, the last two rows were fetched again
+	frame := merged[0]
+	require.Equal(t, 60, frame.Rows())
+	assert.Equal(t, refreshStart.Add(time.Minute), frame.Fields[0].At(0))
+	assert.Equal(t, 1.0, frame.Fields[1].At(56))
+	assert.Equal(t, refreshStart.Add(58*time.Minute), frame.Fields[0].At(57))
+	assert.Equal(t, 2.0, frame.Fields[1].At(57))
+	assert.Equal(t, refreshStart.Add(60*time.Minute), frame.Fields[0].At(59))
+
+	t.Run("should not merge frames with distinct fields", func(t *testing.T) {
+		other := data.Frames{data.NewFrame("result", data.NewField("ts", nil, []time.Time{refreshStart}), data.NewField("volume", nil, []float64{1}))}
+		_, ok := mergeTail(previous, other, refreshStart, refreshStart)
+		assert.False(t, ok)
+	})
+
+	t.Run("should not merge frames without time field", func(t *testing.T) {
+		count := data.Frames{data.NewFrame("result", data.NewField("count", nil, []int64{1}))}
+		_, ok := mergeTail(count, count, refreshStart, refreshStart)
+		assert.False(t, ok)
+	})
+
+	t.Run("should not merge frames out of time order", func(t *testing.T) {
+		reversed := data.Frames{data.NewFrame("result",
+			data.NewField("ts", nil, []time.Time{refreshStart.Add(3 * time.Minute), refreshStart.Add(2 * time.Minute)}),
+			data.NewField("value", nil, []float64{1, 2}))}
+		_, ok := mergeTail(reversed, reversed, refreshStart, refreshStart.Add(time.Minute))
+		assert.False(t, ok)
+	})
+
+	t.Run("should not merge multiple frames", func(t *testing.T) {
+		_, ok := mergeTail(append(previous, previous...), tail, refreshStart, refreshStart)
+		assert.False(t, ok)
+	})
+}
+
+func TestRefreshStoreTail(t *testing.T) {
+	cache := newRefreshCache(Settings{EnableIncrementalRefresh: true})
+	query := newRefreshQuery("", refreshStart, refreshStart.Add(time.Hour))
+	next := newRefreshQuery("", refreshStart.Add(time.Minute), refreshStart.Add(time.Hour+time.Minute))
+
+	cache.storeTail("key", newSampledFrame(0, 60, 1), query.TimeRange)
+	_, _, ok := cache.tail("key", next, 0)
+	assert.True(t, ok)
+
+	// the tail of a result that can't be merged is not fetched, the whole time range is fetched at once
+	count := data.Frames{data.NewFrame("result", data.NewField("count", nil, []int64{1}))}
+	cache.storeTail("key", count, query.TimeRange)
+	_, tail, ok := cache.tail("key", next, 0)
+	assert.False(t, ok)
+	assert.Equal(t, next, tail)
+}
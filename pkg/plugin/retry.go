@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"regexp"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	defaultRetryBackoff    = 200 * time.Millisecond
+	defaultRetryMaxBackoff = 5 * time.Second
+)
+
+// retryPolicy - how often and how fast a query failing with a transient error is run again
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	jitter      time.Duration
+}
+
+// retryPolicy returns the retry policy of the queries. Without a maximum number of attempts queries are not retried,
+// the backoff then doubles after every attempt up to the maximum backoff, and a random jitter is added to each delay.
+func (settings *Settings) retryPolicy() retryPolicy {
+	policy := retryPolicy{
+		maxAttempts: int(max(settings.RetryMaxAttempts, 1)),
+		backoff:     time.Duration(settings.RetryBackoff) * time.Millisecond,
+		maxBackoff:  time.Duration(settings.RetryMaxBackoff) * time.Millisecond,
+		jitter:      time.Duration(settings.RetryJitter) * time.Millisecond,
+	}
+	if policy.backoff == 0 {
+		policy.backoff = defaultRetryBackoff
+	}
+	if policy.maxBackoff == 0 {
+		policy.maxBackoff = max(defaultRetryMaxBackoff, policy.backoff)
+	}
+	return policy
+}
+
+func (settings *Settings) validateRetryPolicy() (errs SettingsErrors) {
+	for field, value := range map[string]int64{
+		"retryMaxAttempts": settings.RetryMaxAttempts,
+		"retryBackoff":     settings.RetryBackoff,
+		"retryMaxBackoff":  settings.RetryMaxBackoff,
+		"retryJitter":      settings.RetryJitter,
+	} {
+		if value < 0 {
+			errs.add(field, ErrorMessageInvalidRetryPolicy)
+		}
+	}
+	return errs
+}
+
+func (p retryPolicy) enabled() bool {
+	return p.maxAttempts > 1
+}
+
+// delay returns the time to wait after the given failed attempt, starting at 1
+func (p retryPolicy) delay(attempt int) time.Duration {
+	delay := p.backoff
+	for i := 1; i < attempt && delay < p.maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.maxBackoff)
+	if p.jitter > 0 {
+		delay += rand.N(p.jitter)
+	}
+	return delay
+}
+
+// do runs the query until it succeeds, fails with an error that is not transient or runs out of attempts.
+// Only idempotent queries are retried. The trace given to the query records the error of the driver,
+// which sqlds only reports as a message. do returns the last response and the number of attempts.
+func (p retryPolicy) do(ctx context.Context, idempotent bool, query func(ctx context.Context) backend.DataResponse) (backend.DataResponse, int) {
+	for attempt := 1; ; attempt++ {
+		trace := &queryTrace{}
+		res := query(withQueryTrace(ctx, trace))
+		err := trace.error()
+		if res.Error == nil || !idempotent || attempt >= p.maxAttempts || ctx.Err() != nil || !isTransient(err) {
+			return res, attempt
+		}
+
+		delay := p.delay(attempt)
+		log.DefaultLogger.Warn("QuestDB query failed with a transient error, retrying", "attempt", attempt, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return res, attempt
+		}
+	}
+}
+
+// isTransient tells whether a query failed because of a connection reset, a restarting server or a busy table
+func isTransient(err error) bool {
+	return err != nil && classifyError(err).transient()
+}
+
+var (
+	sqlCommentPattern   = regexp.MustCompile(`(?s)^\s*(--[^\n]*(\n|$)|/\*.*?\*/)`)
+	readStatementPrefix = regexp.MustCompile(`(?i)^\s*(select|with|show|explain)\b`)
+	writeKeywordPattern = regexp.MustCompile(`(?i)\b(insert|update|delete|create|drop|alter|truncate|rename|copy|backup|vacuum|reindex|cancel|grant|revoke)\b`)
+)
+
+// isIdempotent tells whether running the SQL of the query twice is harmless. Only SELECTs are, and queries mentioning
+// a write keyword anywhere are conservatively excluded, e.g. QuestDB accepts WITH ... INSERT.
+func isIdempotent(query backend.DataQuery) bool {
+	var model struct {
+		RawSQL string `json:"rawSql"`
+	}
+	if err := json.Unmarshal(query.JSON, &model); err != nil {
+		return false
+	}
+	sql := model.RawSQL
+	for {
+		comment := sqlCommentPattern.FindString(sql)
+		if comment == "" {
+			break
+		}
+		sql = sql[len(comment):]
+	}
+	return readStatementPrefix.MatchString(sql) && !writeKeywordPattern.MatchString(sql)
+}
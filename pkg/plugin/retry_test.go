@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	settings := Settings{RetryMaxAttempts: 5, RetryBackoff: 100, RetryMaxBackoff: 300}
+	policy := settings.retryPolicy()
+	assert.True(t, policy.enabled())
+	assert.Equal(t, 100*time.Millisecond, policy.delay(1))
+	assert.Equal(t, 200*time.Millisecond, policy.delay(2))
+	assert.Equal(t, 300*time.Millisecond, policy.delay(3))
+	assert.Equal(t, 300*time.Millisecond, policy.delay(10))
+
+	settings.RetryJitter = 50
+	policy = settings.retryPolicy()
+	for i := 0; i < 10; i++ {
+		delay := policy.delay(1)
+		assert.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		assert.Less(t, delay, 150*time.Millisecond)
+	}
+
+	policy = (&Settings{}).retryPolicy()
+	assert.False(t, policy.enabled())
+	assert.Equal(t, defaultRetryBackoff, policy.delay(1))
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 3, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+	reset := fmt.Errorf("read tcp: %w", syscall.ECONNRESET)
+
+	// failing returns a query failing with the given error for the given number of attempts
+	failing := func(err error, failures int) (func(ctx context.Context) backend.DataResponse, *int) {
+		calls := 0
+		return func(ctx context.Context) backend.DataResponse {
+			calls++
+			if calls > failures {
+				return backend.DataResponse{Frames: data.Frames{data.NewFrame("")}}
+			}
+			queryTraceFromContext(ctx).setError(err)
+			return backend.ErrDataResponse(backend.StatusInternal, err.Error())
+		}, &calls
+	}
+
+	t.Run("should retry transient errors of idempotent queries", func(t *testing.T) {
+		query, calls := failing(reset, 2)
+		res, attempts := policy.do(context.Background(), true, query)
+		assert.NoError(t, res.Error)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("should give up after the maximum number of attempts", func(t *testing.T) {
+		query, calls := failing(reset, 5)
+		res, attempts := policy.do(context.Background(), true, query)
+		assert.Error(t, res.Error)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("should not retry queries that are not idempotent", func(t *testing.T) {
+		query, calls := failing(reset, 1)
+		res, attempts := policy.do(context.Background(), false, query)
+		assert.Error(t, res.Error)
+		assert.Equal(t, 1, attempts)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("should not retry errors that are not transient", func(t *testing.T) {
+		query, calls := failing(&pq.Error{Code: "42601", Message: "syntax error"}, 1)
+		res, attempts := policy.do(context.Background(), true, query)
+		assert.Error(t, res.Error)
+		assert.Equal(t, 1, attempts)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("should stop waiting when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := retryPolicy{maxAttempts: 3, backoff: time.Hour, maxBackoff: time.Hour}
+		query, calls := failing(reset, 5)
+		time.AfterFunc(10*time.Millisecond, cancel)
+		res, attempts := slow.do(ctx, true, query)
+		assert.Error(t, res.Error)
+		assert.Equal(t, 1, attempts)
+		assert.Equal(t, 1, *calls)
+	})
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{err: nil, transient: false},
+		{err: fmt.Errorf("read: %w", syscall.ECONNRESET), transient: true},
+		{err: io.ErrUnexpectedEOF, transient: true},
+		{err: driver.ErrBadConn, transient: true},
+		{err: &pq.Error{Code: "57P01", Message: "terminating connection due to administrator command"}, transient: true},
+		{err: &pq.Error{Code: "08006", Message: "connection failure"}, transient: true},
+		{err: &pgconn.PgError{Code: "57P03", Message: "the database system is starting up"}, transient: true},
+		{err: &pq.Error{Code: "00000", Message: "table busy [reason=insert]"}, transient: true},
+		{err: &pgconn.PgError{Code: "00000", Message: "could not open, Table Busy"}, transient: true},
+		{err: &pq.Error{Code: "42601", Message: "unexpected token"}, transient: false},
+		{err: errors.New("table does not exist [table=foo]"), transient: false},
+		{err: context.DeadlineExceeded, transient: false},
+		{err: context.Canceled, transient: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.transient, isTransient(tt.err), "%v", tt.err)
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		sql        string
+		idempotent bool
+	}{
+		{sql: "SELECT * FROM trades WHERE $__timeFilter(ts)", idempotent: true},
+		{sql: "  select 1", idempotent: true},
+		{sql: "WITH t AS (SELECT 1) SELECT * FROM t", idempotent: true},
+		{sql: "-- comment\n/* another\ncomment */ SELECT 1", idempotent: true},
+		{sql: "SHOW TABLES", idempotent: true},
+		{sql: "INSERT INTO t VALUES (1)", idempotent: false},
+		{sql: "WITH t AS (SELECT 1) INSERT INTO u SELECT * FROM t", idempotent: false},
+		{sql: "SELECT 1; DROP TABLE t", idempotent: false},
+		{sql: "-- SELECT\nUPDATE t SET x = 1", idempotent: false},
+		{sql: "selection", idempotent: false},
+		{sql: "", idempotent: false},
+	}
+	for _, tt := range tests {
+		query := backend.DataQuery{JSON: []byte(fmt.Sprintf(`{"rawSql": %q}`, tt.sql))}
+		assert.Equal(t, tt.idempotent, isIdempotent(query), tt.sql)
+	}
+}
+
+func TestSetCustomMeta(t *testing.T) {
+	frames := data.Frames{data.NewFrame("a"), data.NewFrame("b").SetMeta(&data.FrameMeta{Custom: map[string]interface{}{"foo": "bar"}})}
+	setCustomMeta(frames, "attempts", 2)
+	assert.Equal(t, map[string]interface{}{"attempts": 2}, frames[0].Meta.Custom)
+	assert.Equal(t, map[string]interface{}{"foo": "bar", "attempts": 2}, frames[1].Meta.Custom)
+}
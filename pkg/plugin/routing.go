@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const (
+	// poolDefault is the pool used by dashboards and everything else
+	poolDefault = ""
+	// poolAlerting is the pool used by Grafana alert rule evaluations
+	poolAlerting = "alerting"
+
+	// headerFromAlert is set by Grafana on requests made by the alerting engine
+	headerFromAlert = "FromAlert"
+)
+
+// connectionArgs are passed by sqlds to QuestDB.Connect and select the connection pool
+type connectionArgs struct {
+	Pool string `json:"pool,omitempty"`
+}
+
+type poolKey struct{}
+
+// withPool returns a context routing the queries to the given pool
+func withPool(ctx context.Context, pool string) context.Context {
+	return context.WithValue(ctx, poolKey{}, pool)
+}
+
+func poolFromContext(ctx context.Context) string {
+	pool, _ := ctx.Value(poolKey{}).(string)
+	return pool
+}
+
+// poolName names the pool in logs and metrics
+func poolName(pool string) string {
+	if pool == poolDefault {
+		return "default"
+	}
+	return pool
+}
+
+// isAlertingRequest reports whether the request comes from the Grafana alerting engine
+func isAlertingRequest(req *backend.QueryDataRequest) bool {
+	if strings.EqualFold(req.Headers[headerFromAlert], "true") {
+		return true
+	}
+	return strings.EqualFold(req.GetHTTPHeader(headerFromAlert), "true")
+}
+
+// parseConnectionArgs returns the pool selected by the connection arguments
+func parseConnectionArgs(message json.RawMessage) string {
+	var args connectionArgs
+	if len(message) == 0 || json.Unmarshal(message, &args) != nil {
+		return poolDefault
+	}
+	return args.Pool
+}
+
+// setConnectionArgs replaces the connection arguments of the query, so that sqlds
+// only ever creates a pool for the known routes, whatever the query JSON contains.
+func setConnectionArgs(query json.RawMessage, pool string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(query, &fields); err != nil {
+		return query, err
+	}
+	_, hasArgs := fields["connectionArgs"]
+	if pool == poolDefault && !hasArgs {
+		return query, nil
+	}
+	delete(fields, "connectionArgs")
+	if pool != poolDefault {
+		args, err := json.Marshal(connectionArgs{Pool: pool})
+		if err != nil {
+			return query, err
+		}
+		fields["connectionArgs"] = args
+	}
+	return json.Marshal(fields)
+}
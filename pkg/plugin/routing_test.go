@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAlertingRequest(t *testing.T) {
+	assert.True(t, isAlertingRequest(&backend.QueryDataRequest{Headers: map[string]string{"FromAlert": "true"}}))
+	assert.True(t, isAlertingRequest(&backend.QueryDataRequest{Headers: map[string]string{"http_FromAlert": "true"}}))
+	assert.False(t, isAlertingRequest(&backend.QueryDataRequest{Headers: map[string]string{"FromAlert": "false"}}))
+	assert.False(t, isAlertingRequest(&backend.QueryDataRequest{}))
+}
+
+func TestSetConnectionArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		pool  string
+		want  string
+	}{
+		{name: "should keep default queries untouched", query: `{"rawSql":"select 1"}`, pool: poolDefault, want: `{"rawSql":"select 1"}`},
+		{name: "should route to the alerting pool", query: `{"rawSql":"select 1"}`, pool: poolAlerting, want: `{"connectionArgs":{"pool":"alerting"},"rawSql":"select 1"}`},
+		{name: "should drop connection arguments of the query", query: `{"connectionArgs":{"foo":"bar"},"rawSql":"select 1"}`, pool: poolDefault, want: `{"rawSql":"select 1"}`},
+		{name: "should replace connection arguments of the query", query: `{"connectionArgs":{"pool":"x"},"rawSql":"select 1"}`, pool: poolAlerting, want: `{"connectionArgs":{"pool":"alerting"},"rawSql":"select 1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := setConnectionArgs(json.RawMessage(tt.query), tt.pool)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+			assert.Equal(t, tt.pool, parseConnectionArgs(func() json.RawMessage {
+				var q struct {
+					ConnectionArgs json.RawMessage `json:"connectionArgs"`
+				}
+				require.NoError(t, json.Unmarshal(got, &q))
+				return q.ConnectionArgs
+			}()))
+		})
+	}
+}
+
+func TestMutateQueryRouting(t *testing.T) {
+	h := QuestDB{}
+	ctx := withPool(context.Background(), poolAlerting)
+	_, q := h.MutateQuery(ctx, backend.DataQuery{JSON: []byte(`{"rawSql":"select 1","meta":{"timezone":"UTC"}}`)})
+	assert.JSONEq(t, `{"connectionArgs":{"pool":"alerting"},"rawSql":"select 1","meta":{"timezone":"UTC"}}`, string(q.JSON))
+}
+
+func TestSettingsForPool(t *testing.T) {
+	settings := Settings{
+		Server:                     "primary",
+		Port:                       8812,
+		Hosts:                      []Host{{Server: "replica", Port: 8812, Priority: 1}},
+		Timeout:                    10,
+		QueryTimeout:               60,
+		MaxOpenConnections:         100,
+		MaxIdleConnections:         50,
+		MaxConnectionLifetime:      3600,
+		EnableAlertingPool:         true,
+		AlertingServer:             "alerts",
+		AlertingPort:               8813,
+		AlertingQueryTimeout:       30,
+		AlertingMaxOpenConnections: 5,
+	}
+
+	assert.Equal(t, settings, settings.forPool(poolDefault))
+
+	alerting := settings.forPool(poolAlerting)
+	assert.Equal(t, []Host{{Server: "alerts", Port: 8813}}, alerting.Endpoints())
+	assert.Equal(t, int64(10), alerting.Timeout)
+	assert.Equal(t, int64(30), alerting.QueryTimeout)
+	assert.Equal(t, int64(5), alerting.MaxOpenConnections)
+	assert.Equal(t, int64(50), alerting.MaxIdleConnections)
+	assert.Equal(t, int64(3600), alerting.MaxConnectionLifetime)
+
+	settings.AlertingServer = ""
+	alerting = settings.forPool(poolAlerting)
+	assert.Equal(t, settings.Endpoints(), alerting.Endpoints())
+
+	settings.EnableAlertingPool = false
+	assert.Equal(t, settings, settings.forPool(poolAlerting))
+}
+
+func TestSettingsQueryTimeout(t *testing.T) {
+	settings := Settings{QueryTimeout: 60, EnableAlertingPool: true, AlertingQueryTimeout: 300}
+	assert.Equal(t, 60*time.Second, settings.queryTimeout(poolDefault))
+	assert.Equal(t, 300*time.Second, settings.queryTimeout(poolAlerting))
+	// sqlds must not cut the longer alerting queries
+	assert.Equal(t, 300*time.Second, settings.driverTimeout())
+
+	settings.AlertingQueryTimeout = 30
+	assert.Equal(t, 60*time.Second, settings.driverTimeout())
+
+	settings.EnableAlertingPool = false
+	assert.Equal(t, 60*time.Second, settings.queryTimeout(poolAlerting))
+	assert.Equal(t, 60*time.Second, settings.driverTimeout())
+
+	settings = Settings{EnableAlertingPool: true, AlertingQueryTimeout: 30}
+	assert.Equal(t, time.Duration(0), settings.driverTimeout())
+	assert.Equal(t, 30*time.Second, settings.queryTimeout(poolAlerting))
+}
@@ -0,0 +1,303 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+)
+
+const (
+	defaultSchemaCacheTTL = 5 * time.Minute
+	defaultSchemaPageSize = 1000
+	maxSchemaPageSize     = 10000
+)
+
+func (settings *Settings) validateSchemaCache() (errs SettingsErrors) {
+	if settings.SchemaCacheTTL < 0 {
+		errs.add("schemaCacheTTL", ErrorMessageInvalidSchemaCache)
+	}
+	return errs
+}
+
+// schemaCacheTTL returns how long the schema is cached
+func (settings *Settings) schemaCacheTTL() time.Duration {
+	if settings.SchemaCacheTTL == 0 {
+		return defaultSchemaCacheTTL
+	}
+	return time.Duration(settings.SchemaCacheTTL) * time.Second
+}
+
+// SchemaTable - table as listed by tables()
+type SchemaTable struct {
+	Name                string `json:"tableName"`
+	PartitionBy         string `json:"partitionBy"`
+	DesignatedTimestamp string `json:"designatedTimestamp"`
+	WalEnabled          bool   `json:"walEnabled"`
+	Dedup               bool   `json:"dedup"`
+}
+
+// SchemaColumn - column as listed by table_columns()
+type SchemaColumn struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Designated bool   `json:"designated"`
+}
+
+// SchemaFunction - signature of a function as listed by functions()
+type SchemaFunction struct {
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Type      string `json:"type"`
+}
+
+// SchemaPage - page of the schema items matching the search, total is the number of matching items
+type SchemaPage struct {
+	Items  interface{} `json:"items"`
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+var schemaResourcePattern = regexp.MustCompile(`^/?(tables(/[^/]+/columns)?|functions|keywords)/?$`)
+
+// schemaResources serves the schema of QuestDB to the editor: the tables, the columns of a table, the functions and
+// the keywords. The lists are cached, as the editor asks for them every time it opens, and are searched and paged
+// on the server, so that schemas with thousands of tables are not sent to the browser at once.
+type schemaResources struct {
+	db      func(ctx context.Context) (*sql.DB, error)
+	ttl     time.Duration
+	handler backend.CallResourceHandler
+
+	mu      sync.Mutex
+	entries map[string]schemaEntry
+	now     func() time.Time
+}
+
+type schemaEntry struct {
+	items   interface{}
+	expires time.Time
+}
+
+func newSchemaResources(ttl time.Duration, db func(ctx context.Context) (*sql.DB, error)) *schemaResources {
+	s := &schemaResources{db: db, ttl: ttl, entries: map[string]schemaEntry{}, now: time.Now}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tables", s.tables)
+	mux.HandleFunc("GET /tables/{name}/columns", s.columns)
+	mux.HandleFunc("GET /functions", s.functions)
+	mux.HandleFunc("GET /keywords", s.keywords)
+	s.handler = httpadapter.New(mux)
+	return s
+}
+
+// handles tells whether the resource is part of the schema, the others are served by sqlds
+func (s *schemaResources) handles(path string) bool {
+	return schemaResourcePattern.MatchString(path)
+}
+
+func (s *schemaResources) tables(rw http.ResponseWriter, req *http.Request) {
+	serveSchema(s, rw, req, "tables", queryTables, func(table SchemaTable) string { return table.Name })
+}
+
+func (s *schemaResources) columns(rw http.ResponseWriter, req *http.Request) {
+	table := req.PathValue("name")
+	query := func(ctx context.Context, db *sql.DB) ([]SchemaColumn, error) {
+		return queryColumns(ctx, db, table)
+	}
+	serveSchema(s, rw, req, "columns/"+table, query, func(column SchemaColumn) string { return column.Name })
+}
+
+func (s *schemaResources) functions(rw http.ResponseWriter, req *http.Request) {
+	serveSchema(s, rw, req, "functions", queryFunctions, func(function SchemaFunction) string { return function.Name })
+}
+
+func (s *schemaResources) keywords(rw http.ResponseWriter, req *http.Request) {
+	query := func(ctx context.Context, db *sql.DB) ([]string, error) {
+		return queryStrings(ctx, db, "SELECT keyword FROM keywords()")
+	}
+	serveSchema(s, rw, req, "keywords", query, func(keyword string) string { return keyword })
+}
+
+// serveSchema writes the page of the cached items requested, the items are named for the search
+func serveSchema[T any](s *schemaResources, rw http.ResponseWriter, req *http.Request, key string,
+	query func(ctx context.Context, db *sql.DB) ([]T, error), name func(item T) string) {
+	refresh, _ := strconv.ParseBool(req.URL.Query().Get("refresh"))
+	items, err := s.load(req.Context(), key, refresh, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		return query(ctx, db)
+	})
+	if err != nil {
+		queryErr := classifyError(err)
+		http.Error(rw, queryErr.Message, int(queryErr.Status()))
+		return
+	}
+	writeSchemaPage(rw, req, items.([]T), name)
+}
+
+// load returns the cached items, or queries them when they are not cached or a refresh is asked for
+func (s *schemaResources) load(ctx context.Context, key string, refresh bool, query func(ctx context.Context, db *sql.DB) (interface{}, error)) (interface{}, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	s.mu.Unlock()
+	if ok && !refresh && s.now().Before(entry.expires) {
+		return entry.items, nil
+	}
+
+	db, err := s.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := query(ctx, db)
+	if err != nil {
+		log.DefaultLogger.Debug("QuestDB schema query failed", "resource", key, "error", err)
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.entries {
+		if !s.now().Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = schemaEntry{items: items, expires: s.now().Add(s.ttl)}
+	return items, nil
+}
+
+// tableColumns returns the cached columns of the table
+func (s *schemaResources) tableColumns(ctx context.Context, table string) ([]SchemaColumn, error) {
+	// the lookups run while queries are mutated, they must not be recorded as the query in the trace of the panel
+	ctx = withQueryTrace(ctx, nil)
+	columns, err := s.load(ctx, "columns/"+table, false, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		return queryColumns(ctx, db, table)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return columns.([]SchemaColumn), nil
+}
+
+func queryTables(ctx context.Context, db *sql.DB) ([]SchemaTable, error) {
+	rows, err := db.QueryContext(ctx, "SELECT table_name, partitionBy, designatedTimestamp, walEnabled, dedup FROM tables() ORDER BY table_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := []SchemaTable{}
+	for rows.Next() {
+		var table SchemaTable
+		var partitionBy, designatedTimestamp sql.NullString
+		if err := rows.Scan(&table.Name, &partitionBy, &designatedTimestamp, &table.WalEnabled, &table.Dedup); err != nil {
+			return nil, err
+		}
+		table.PartitionBy, table.DesignatedTimestamp = partitionBy.String, designatedTimestamp.String
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func queryColumns(ctx context.Context, db *sql.DB, table string) ([]SchemaColumn, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT "column", type, designated FROM table_columns('%s')`, strings.ReplaceAll(table, "'", "''")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := []SchemaColumn{}
+	for rows.Next() {
+		var column SchemaColumn
+		if err := rows.Scan(&column.Name, &column.Type, &column.Designated); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func queryFunctions(ctx context.Context, db *sql.DB) ([]SchemaFunction, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, signature, type FROM functions() ORDER BY name, signature")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	functions := []SchemaFunction{}
+	for rows.Next() {
+		var function SchemaFunction
+		if err := rows.Scan(&function.Name, &function.Signature, &function.Type); err != nil {
+			return nil, err
+		}
+		functions = append(functions, function)
+	}
+	return functions, rows.Err()
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// writeSchemaPage writes the page of the items whose name contains the search, case-insensitively.
+// The page is given by the offset and limit parameters of the request.
+func writeSchemaPage[T any](rw http.ResponseWriter, req *http.Request, items []T, name func(item T) string) {
+	query := req.URL.Query()
+	offset, limit, err := pageOf(query.Get("offset"), query.Get("limit"))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	search := strings.ToLower(query.Get("search"))
+	matches := []T{}
+	for _, item := range items {
+		if strings.Contains(strings.ToLower(name(item)), search) {
+			matches = append(matches, item)
+		}
+	}
+	// the end is computed from the start, offset+limit overflows for huge offsets
+	start := min(offset, len(matches))
+	end := start + min(limit, len(matches)-start)
+	page := SchemaPage{
+		Items:  matches[start:end],
+		Total:  len(matches),
+		Offset: offset,
+		Limit:  limit,
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(page); err != nil {
+		log.DefaultLogger.Error("QuestDB schema serialization failed", "error", err)
+	}
+}
+
+func pageOf(offsetParam, limitParam string) (offset, limit int, err error) {
+	limit = defaultSchemaPageSize
+	if offsetParam != "" {
+		if offset, err = strconv.Atoi(offsetParam); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", offsetParam)
+		}
+	}
+	if limitParam != "" {
+		if limit, err = strconv.Atoi(limitParam); err != nil || limit <= 0 || limit > maxSchemaPageSize {
+			return 0, 0, fmt.Errorf("invalid limit %q, expected 1 to %d", limitParam, maxSchemaPageSize)
+		}
+	}
+	return offset, limit, nil
+}
@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaResources(t *testing.T) {
+	var queries atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		queries.Add(1)
+		switch {
+		case query == "SELECT 1":
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"1","type":"INT"}],"dataset":[[1]]}`)
+		case strings.Contains(query, "FROM tables()"):
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"table_name","type":"STRING"},{"name":"partitionBy","type":"STRING"},`+
+				`{"name":"designatedTimestamp","type":"STRING"},{"name":"walEnabled","type":"BOOLEAN"},{"name":"dedup","type":"BOOLEAN"}],`+
+				`"dataset":[["prices","DAY","ts",true,false],["trades","HOUR","ts",true,true],["users","NONE",null,false,false]]}`)
+		case strings.Contains(query, "FROM table_columns('trades')"):
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"column","type":"STRING"},{"name":"type","type":"STRING"},{"name":"designated","type":"BOOLEAN"}],`+
+				`"dataset":[["ts","TIMESTAMP",true],["price","DOUBLE",false]]}`)
+		case strings.Contains(query, "FROM functions()"):
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"name","type":"STRING"},{"name":"signature","type":"STRING"},{"name":"type","type":"STRING"}],`+
+				`"dataset":[["avg","avg(D)","GROUP_BY"],["now","now()","STANDARD"]]}`)
+		case strings.Contains(query, "FROM keywords()"):
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"keyword","type":"STRING"}],"dataset":[["add"],["align"],["select"]]}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"table does not exist [table=missing]","position":37}`)
+		}
+	}))
+	defer server.Close()
+	settings, host := httpSettings(t, server)
+	connector, err := newHostConnector(settings, host, "", nil)
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	schema := newSchemaResources(time.Minute, func(context.Context) (*sql.DB, error) { return db, nil })
+	call := func(t *testing.T, url string) (int, []byte) {
+		path, _, _ := strings.Cut(url, "?")
+		require.True(t, schema.handles(path))
+		var res *backend.CallResourceResponse
+		err := schema.handler.CallResource(context.Background(), &backend.CallResourceRequest{Method: http.MethodGet, Path: path, URL: url},
+			backend.CallResourceResponseSenderFunc(func(r *backend.CallResourceResponse) error {
+				res = r
+				return nil
+			}))
+		require.NoError(t, err)
+		return res.Status, res.Body
+	}
+
+	t.Run("should list the tables", func(t *testing.T) {
+		status, body := call(t, "tables")
+		require.Equal(t, http.StatusOK, status)
+		var page struct {
+			Items []SchemaTable `json:"items"`
+			Total int           `json:"total"`
+		}
+		require.NoError(t, json.Unmarshal(body, &page))
+		assert.Equal(t, 3, page.Total)
+		assert.Equal(t, SchemaTable{Name: "trades", PartitionBy: "HOUR", DesignatedTimestamp: "ts", WalEnabled: true, Dedup: true}, page.Items[1])
+		assert.Equal(t, "", page.Items[2].DesignatedTimestamp)
+	})
+
+	t.Run("should search and page the tables", func(t *testing.T) {
+		status, body := call(t, "tables?search=R&offset=1&limit=1")
+		require.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"items":[{"tableName":"trades","partitionBy":"HOUR","designatedTimestamp":"ts","walEnabled":true,"dedup":true}],`+
+			`"total":3,"offset":1,"limit":1}`, string(body))
+
+		status, body = call(t, "tables?search=none&offset=5")
+		require.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"items":[],"total":0,"offset":5,"limit":1000}`, string(body))
+
+		status, body = call(t, "tables?offset=9223372036854775807&limit=1000")
+		require.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"items":[],"total":3,"offset":9223372036854775807,"limit":1000}`, string(body))
+
+		status, _ = call(t, "tables?limit=0")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("should cache the schema until refreshed", func(t *testing.T) {
+		before := queries.Load()
+		call(t, "tables")
+		assert.Equal(t, before, queries.Load())
+		call(t, "tables?refresh=true")
+		assert.Less(t, before, queries.Load())
+
+		schema.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		defer func() { schema.now = time.Now }()
+		before = queries.Load()
+		call(t, "tables")
+		assert.Less(t, before, queries.Load())
+	})
+
+	t.Run("should list the columns of a table", func(t *testing.T) {
+		status, body := call(t, "tables/trades/columns")
+		require.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"items":[{"name":"ts","type":"TIMESTAMP","designated":true},{"name":"price","type":"DOUBLE","designated":false}],`+
+			`"total":2,"offset":0,"limit":1000}`, string(body))
+
+		status, body = call(t, "tables/missing/columns")
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Contains(t, string(body), "table does not exist")
+	})
+
+	t.Run("should list the functions and keywords", func(t *testing.T) {
+		status, body := call(t, "functions?search=AVG")
+		require.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"items":[{"name":"avg","signature":"avg(D)","type":"GROUP_BY"}],"total":1,"offset":0,"limit":1000}`, string(body))
+
+		status, body = call(t, "keywords?search=a")
+		require.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"items":["add","align"],"total":2,"offset":0,"limit":1000}`, string(body))
+	})
+
+	t.Run("should leave the other resources to sqlds", func(t *testing.T) {
+		assert.False(t, schema.handles("schemas"))
+		assert.False(t, schema.handles("columns"))
+		assert.False(t, schema.handles("tables/a/b/columns"))
+	})
+}
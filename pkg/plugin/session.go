@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var settingNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// sessionStatements returns the statements run on every new connection, the custom settings first
+func (settings *Settings) sessionStatements() []string {
+	var statements []string
+	for _, setting := range settings.CustomSettings {
+		statements = append(statements, fmt.Sprintf("SET %s = '%s'", setting.Setting, strings.ReplaceAll(setting.Value, "'", "''")))
+	}
+	for _, statement := range settings.InitStatements {
+		statements = append(statements, normalizeStatement(statement))
+	}
+	return statements
+}
+
+func normalizeStatement(statement string) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";"))
+}
+
+// validateSession checks that custom settings have a valid name and that init statements are single statements
+func (settings *Settings) validateSession() (errs SettingsErrors) {
+	for i, setting := range settings.CustomSettings {
+		if !settingNamePattern.MatchString(setting.Setting) {
+			errs.add(fmt.Sprintf("customSettings[%d]", i), fmt.Errorf("%q: %w", setting.Setting, ErrorMessageInvalidCustomSetting))
+		}
+	}
+	for i, statement := range settings.InitStatements {
+		statement = normalizeStatement(statement)
+		if statement == "" || hasStatementSeparator(statement) {
+			errs.add(fmt.Sprintf("initStatements[%d]", i), fmt.Errorf("%q: %w", statement, ErrorMessageInvalidInitStatement))
+		}
+	}
+	return errs
+}
+
+// hasStatementSeparator tells whether the statement has a ; outside of its quoted literals and identifiers
+func hasStatementSeparator(statement string) bool {
+	var quote rune
+	for _, r := range statement {
+		switch {
+		case quote != 0:
+			// a doubled quote escapes the quote, it closes and opens the literal again
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';':
+			return true
+		}
+	}
+	return false
+}
+
+// InitStatementError - session statement that failed on a new connection
+type InitStatementError struct {
+	Statement string
+	Err       error
+}
+
+func (e *InitStatementError) Error() string {
+	return fmt.Sprintf("session statement %q failed: %s", e.Statement, e.Err)
+}
+
+func (e *InitStatementError) Unwrap() error {
+	return e.Err
+}
+
+// SessionStatus - outcome of a session statement, reported by CheckHealth
+type SessionStatus struct {
+	Statement string `json:"statement"`
+	Applied   bool   `json:"applied"`
+	Error     string `json:"error,omitempty"`
+}
+
+// sessionConnector runs the session statements on every connection before handing it to the pool
+type sessionConnector struct {
+	driver.Connector
+	statements []string
+}
+
+// Connect implements driver.Connector
+func (c *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := initSession(ctx, conn, c.statements); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func initSession(ctx context.Context, conn driver.Conn, statements []string) error {
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		return fmt.Errorf("QuestDB driver does not support session statements")
+	}
+	for _, statement := range statements {
+		if _, err := execer.ExecContext(ctx, statement, nil); err != nil {
+			return &InitStatementError{Statement: statement, Err: err}
+		}
+	}
+	return nil
+}
+
+// sessionStatus reports every session statement as applied up to the one that failed with the given error
+func sessionStatus(statements []string, err error) []SessionStatus {
+	var failed *InitStatementError
+	if err != nil && !errors.As(err, &failed) {
+		return nil
+	}
+	status := make([]SessionStatus, len(statements))
+	applied := true
+	for i, statement := range statements {
+		status[i].Statement = statement
+		if failed != nil && statement == failed.Statement && applied {
+			status[i].Error = failed.Err.Error()
+			applied = false
+			continue
+		}
+		status[i].Applied = applied
+	}
+	return status
+}
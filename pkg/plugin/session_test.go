@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// execConn records the executed statements and fails the ones listed in fail
+type execConn struct {
+	fakeConn
+	executed []string
+	fail     map[string]error
+	closed   bool
+}
+
+func (c *execConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := c.fail[query]; err != nil {
+		return nil, err
+	}
+	c.executed = append(c.executed, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *execConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+type execConnector struct {
+	conn *execConn
+}
+
+func (c *execConnector) Connect(_ context.Context) (driver.Conn, error) { return c.conn, nil }
+
+func (c *execConnector) Driver() driver.Driver { return nil }
+
+func TestSessionStatements(t *testing.T) {
+	settings := Settings{
+		CustomSettings: []CustomSetting{{Setting: "statement_timeout", Value: "10s"}, {Setting: "app.name", Value: "it's"}},
+		InitStatements: []string{" SELECT 1; ", "SET x = 'a;b'", `SET "y;z" = 'it''s;'`},
+	}
+	assert.Equal(t, []string{"SET statement_timeout = '10s'", "SET app.name = 'it''s'", "SELECT 1", "SET x = 'a;b'", `SET "y;z" = 'it''s;'`},
+		settings.sessionStatements())
+	assert.Empty(t, settings.validateSession())
+
+	settings = Settings{
+		CustomSettings: []CustomSetting{{Setting: "x; DROP TABLE t", Value: "1"}},
+		InitStatements: []string{"SELECT 1; SELECT 2", " ; ", "SET x = 'a;b'; SELECT 2"},
+	}
+	errs := settings.validateSession()
+	require.Len(t, errs, 4)
+	assert.Equal(t, "customSettings[0]", errs[0].Field)
+	assert.ErrorIs(t, errs[0], ErrorMessageInvalidCustomSetting)
+	assert.Equal(t, "initStatements[0]", errs[1].Field)
+	assert.ErrorIs(t, errs[2], ErrorMessageInvalidInitStatement)
+	assert.Equal(t, "initStatements[2]", errs[3].Field)
+}
+
+func TestSessionConnector(t *testing.T) {
+	statements := []string{"SET a = '1'", "SET b = '2'", "SET c = '3'"}
+
+	t.Run("should run the statements on new connections", func(t *testing.T) {
+		conn := &execConn{}
+		connector := &sessionConnector{Connector: &execConnector{conn: conn}, statements: statements}
+		_, err := connector.Connect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, statements, conn.executed)
+		assert.False(t, conn.closed)
+	})
+
+	t.Run("should close the connection when a statement fails", func(t *testing.T) {
+		conn := &execConn{fail: map[string]error{"SET b = '2'": errors.New("unknown setting")}}
+		connector := &sessionConnector{Connector: &execConnector{conn: conn}, statements: statements}
+		_, err := connector.Connect(context.Background())
+		var statementErr *InitStatementError
+		require.ErrorAs(t, err, &statementErr)
+		assert.Equal(t, "SET b = '2'", statementErr.Statement)
+		assert.True(t, conn.closed)
+
+		assert.Equal(t, []SessionStatus{
+			{Statement: "SET a = '1'", Applied: true},
+			{Statement: "SET b = '2'", Error: "unknown setting"},
+			{Statement: "SET c = '3'"},
+		}, sessionStatus(statements, err))
+	})
+
+	t.Run("should report every statement as applied", func(t *testing.T) {
+		status := sessionStatus(statements, nil)
+		require.Len(t, status, 3)
+		for _, s := range status {
+			assert.True(t, s.Applied)
+		}
+		assert.Nil(t, sessionStatus(statements, errors.New("connection refused")))
+	})
+}
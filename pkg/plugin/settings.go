@@ -2,9 +2,13 @@ package plugin
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
@@ -27,156 +31,440 @@ type Settings struct {
 	MaxConnectionLifetime  int64  `json:"maxConnectionLifetime,omitempty"`
 	TimeInterval           string `json:"timeInterval,omitempty"`
 	EnableSecureSocksProxy bool   `json:"enableSecureSocksProxy,omitempty"`
+	Driver                 string `json:"driver,omitempty"`
+	Transport              string `json:"transport,omitempty"`
+	HttpToken              string
+
+	DisableKeepAlive  bool  `json:"disableKeepAlive,omitempty"`
+	KeepAliveIdle     int64 `json:"keepAliveIdle,omitempty"`
+	KeepAliveInterval int64 `json:"keepAliveInterval,omitempty"`
+	KeepAliveCount    int64 `json:"keepAliveCount,omitempty"`
 
 	TlsMode             string `json:"tlsMode"`
 	ConfigurationMethod string `json:"tlsConfigurationMethod"`
+	TlsServerName       string `json:"tlsServerName,omitempty"`
+	TlsMinVersion       string `json:"tlsMinVersion,omitempty"`
 
+	TlsCACertFile     string `json:"tlsCACertFile"`
 	TlsClientCertFile string `json:"tlsClientCertFile"`
 	TlsClientKeyFile  string `json:"tlsClientKeyFile"`
+
+	Hosts             []Host `json:"hosts,omitempty"`
+	HostProbeInterval int64  `json:"hostProbeInterval,omitempty"`
+
+	EnableSshTunnel bool   `json:"enableSshTunnel,omitempty"`
+	SshHost         string `json:"sshHost,omitempty"`
+	SshPort         int64  `json:"sshPort,omitempty"`
+	SshUser         string `json:"sshUser,omitempty"`
+	SshKnownHosts   string `json:"sshKnownHosts,omitempty"`
+	SshPrivateKey   string
+	SshPassphrase   string
+
+	RetryMaxAttempts int64 `json:"retryMaxAttempts,omitempty"`
+	RetryBackoff     int64 `json:"retryBackoff,omitempty"`
+	RetryMaxBackoff  int64 `json:"retryMaxBackoff,omitempty"`
+	RetryJitter      int64 `json:"retryJitter,omitempty"`
+
+	CacheTTL       int64 `json:"cacheTTL,omitempty"`
+	CacheMaxMemory int64 `json:"cacheMaxMemory,omitempty"`
+
+	EnableIncrementalRefresh  bool  `json:"enableIncrementalRefresh,omitempty"`
+	IncrementalRefreshOverlap int64 `json:"incrementalRefreshOverlap,omitempty"`
+
+	StreamPollInterval int64 `json:"streamPollInterval,omitempty"`
+	StreamMaxRows      int64 `json:"streamMaxRows,omitempty"`
+
+	SchemaCacheTTL int64 `json:"schemaCacheTTL,omitempty"`
+
+	CustomSettings []CustomSetting `json:"customSettings,omitempty"`
+	InitStatements []string        `json:"initStatements,omitempty"`
+
+	EnableAlertingPool            bool   `json:"enableAlertingPool,omitempty"`
+	AlertingServer                string `json:"alertingServer,omitempty"`
+	AlertingPort                  int64  `json:"alertingPort,omitempty"`
+	AlertingTimeout               int64  `json:"alertingTimeout,omitempty"`
+	AlertingQueryTimeout          int64  `json:"alertingQueryTimeout,omitempty"`
+	AlertingMaxOpenConnections    int64  `json:"alertingMaxOpenConnections,omitempty"`
+	AlertingMaxIdleConnections    int64  `json:"alertingMaxIdleConnections,omitempty"`
+	AlertingMaxConnectionLifetime int64  `json:"alertingMaxConnectionLifetime,omitempty"`
 }
 
+// Host - additional QuestDB endpoint (e.g. a replica) used for failover and load balancing.
+// Hosts with a lower priority value are preferred, the main server always has priority 0.
+// Hosts sharing the same priority are load-balanced.
+type Host struct {
+	Server   string `json:"server"`
+	Port     int64  `json:"port"`
+	Priority int64  `json:"priority"`
+}
+
+func (h Host) String() string {
+	return fmt.Sprintf("%s:%d", h.Server, h.Port)
+}
+
+// CustomSetting - session parameter set on every new connection
 type CustomSetting struct {
 	Setting string `json:"setting"`
 	Value   string `json:"value"`
 }
 
-func (settings *Settings) isValid() (err error) {
+// isValid checks every setting and returns all the invalid ones as SettingsErrors
+func (settings *Settings) isValid() error {
+	var errs SettingsErrors
 	if settings.Server == "" {
-		return ErrorMessageInvalidServerName
+		errs.add("server", ErrorMessageInvalidServerName)
 	}
 	if settings.Port <= 0 {
-		return ErrorMessageInvalidPort
+		errs.add("port", ErrorMessageInvalidPort)
 	}
-	if len(settings.Username) == 0 {
-		return ErrorMessageInvalidUserName
-	}
-	if len(settings.Password) == 0 {
-		return ErrorMessageInvalidPassword
+	// a token authenticates the requests of the HTTP transport on its own
+	if settings.Transport != transportHTTP || settings.HttpToken == "" {
+		if len(settings.Username) == 0 {
+			errs.add("username", ErrorMessageInvalidUserName)
+		}
+		if len(settings.Password) == 0 {
+			errs.add("password", ErrorMessageInvalidPassword)
+		}
 	}
-	return nil
-}
-
-// LoadSettings will read and validate Settings from the DataSourceConfig
-func LoadSettings(config backend.DataSourceInstanceSettings) (settings Settings, err error) {
-	var jsonData map[string]interface{}
-	if err := json.Unmarshal(config.JSONData, &jsonData); err != nil {
-		return settings, fmt.Errorf("%s: %w", err.Error(), ErrorMessageInvalidJSON)
+	if settings.Driver != "" && settings.Driver != driverPq && settings.Driver != driverPgx {
+		errs.add("driver", ErrorMessageInvalidDriver)
 	}
-
-	if jsonData["server"] != nil {
-		settings.Server = jsonData["server"].(string)
+	errs = append(errs, settings.validateTransport()...)
+	errs = append(errs, settings.validateTlsFiles()...)
+	if _, ok := tlsVersions[settings.TlsMinVersion]; settings.TlsMinVersion != "" && !ok {
+		errs.add("tlsMinVersion", ErrorMessageInvalidTlsMinVersion)
 	}
-	if jsonData["port"] != nil {
-		if port, ok := jsonData["port"].(string); ok {
-			settings.Port, err = strconv.ParseInt(port, 0, 64)
-			if err != nil {
-				return settings, fmt.Errorf("could not parse port value: %w", err)
-			}
-		} else {
-			settings.Port = int64(jsonData["port"].(float64))
+	seen := map[string]bool{settings.Endpoints()[0].String(): true}
+	for i, host := range settings.Hosts {
+		field := fmt.Sprintf("hosts[%d]", i)
+		switch {
+		case host.Server == "":
+			errs.add(field, ErrorMessageInvalidHost)
+		case host.Port <= 0 || host.Priority < 0:
+			errs.add(field, fmt.Errorf("%s: %w", host, ErrorMessageInvalidHost))
+		case seen[host.String()]:
+			errs.add(field, fmt.Errorf("%s: %w", host, ErrorMessageDuplicateHost))
 		}
+		seen[host.String()] = true
 	}
-	if jsonData["username"] != nil {
-		settings.Username = jsonData["username"].(string)
+	if settings.HostProbeInterval < 0 {
+		errs.add("hostProbeInterval", ErrorMessageInvalidHostProbeInterval)
 	}
-
-	if jsonData["timeout"] != nil {
-		if val, ok := jsonData["timeout"].(string); ok {
-			timeout, err := strconv.ParseInt(val, 0, 64)
-			if err != nil {
-				return settings, fmt.Errorf("could not parse timeout value: %w", err)
-			}
-			settings.Timeout = timeout
-		}
-		if val, ok := jsonData["timeout"].(float64); ok {
-			settings.Timeout = int64(val)
+	errs = append(errs, settings.validateKeepAlive()...)
+	errs = append(errs, settings.validateSshTunnel()...)
+	errs = append(errs, settings.validateRetryPolicy()...)
+	errs = append(errs, settings.validateCache()...)
+	errs = append(errs, settings.validateIncrementalRefresh()...)
+	errs = append(errs, settings.validateStream()...)
+	errs = append(errs, settings.validateSchemaCache()...)
+	errs = append(errs, settings.validateSession()...)
+	if settings.EnableAlertingPool {
+		if settings.AlertingServer != "" && settings.AlertingPort <= 0 {
+			errs.add("alertingPort", ErrorMessageInvalidAlertingPort)
 		}
-	}
-	if jsonData["queryTimeout"] != nil {
-		if val, ok := jsonData["queryTimeout"].(int64); ok {
-			settings.QueryTimeout = val
-		}
-		if val, ok := jsonData["queryTimeout"].(float64); ok {
-			settings.QueryTimeout = int64(val)
+		for field, value := range map[string]int64{
+			"alertingTimeout":               settings.AlertingTimeout,
+			"alertingQueryTimeout":          settings.AlertingQueryTimeout,
+			"alertingMaxOpenConnections":    settings.AlertingMaxOpenConnections,
+			"alertingMaxIdleConnections":    settings.AlertingMaxIdleConnections,
+			"alertingMaxConnectionLifetime": settings.AlertingMaxConnectionLifetime,
+		} {
+			if value < 0 {
+				errs.add(field, ErrorMessageInvalidAlertingPool)
+			}
 		}
 	}
+	return errs.orNil()
+}
 
-	if strings.TrimSpace(strconv.FormatInt(settings.QueryTimeout, 10)) == "" {
-		settings.QueryTimeout = 60
+// forPool returns the settings used to open the connections of the given pool.
+// The alerting pool may point at a dedicated host and has its own limits, unset values fall back to the main ones.
+func (settings Settings) forPool(pool string) Settings {
+	if pool != poolAlerting || !settings.EnableAlertingPool {
+		return settings
+	}
+	if settings.AlertingServer != "" {
+		settings.Server = settings.AlertingServer
+		settings.Port = settings.AlertingPort
+		settings.Hosts = nil
 	}
-	password, ok := config.DecryptedSecureJSONData["password"]
-	if ok {
-		settings.Password = password
+	if settings.AlertingTimeout > 0 {
+		settings.Timeout = settings.AlertingTimeout
 	}
-	tlsCACert, ok := config.DecryptedSecureJSONData["tlsCACert"]
-	if ok {
-		settings.TlsCACert = tlsCACert
+	if settings.AlertingQueryTimeout > 0 {
+		settings.QueryTimeout = settings.AlertingQueryTimeout
 	}
-	tlsClientCert, ok := config.DecryptedSecureJSONData["tlsClientCert"]
-	if ok {
-		settings.TlsClientCert = tlsClientCert
+	if settings.AlertingMaxOpenConnections > 0 {
+		settings.MaxOpenConnections = settings.AlertingMaxOpenConnections
 	}
-	tlsClientKey, ok := config.DecryptedSecureJSONData["tlsClientKey"]
-	if ok {
-		settings.TlsClientKey = tlsClientKey
+	if settings.AlertingMaxIdleConnections > 0 {
+		settings.MaxIdleConnections = settings.AlertingMaxIdleConnections
 	}
+	if settings.AlertingMaxConnectionLifetime > 0 {
+		settings.MaxConnectionLifetime = settings.AlertingMaxConnectionLifetime
+	}
+	return settings
+}
 
-	if jsonData["tlsConfigurationMethod"] != nil {
-		settings.ConfigurationMethod = jsonData["tlsConfigurationMethod"].(string)
+// queryTimeout returns the timeout of the queries of the given pool, zero when they have none
+func (settings Settings) queryTimeout(pool string) time.Duration {
+	return time.Duration(settings.forPool(pool).QueryTimeout) * time.Second
+}
+
+// driverTimeout returns the timeout sqlds applies to the queries of every pool, the longest of the pools, so that
+// the alerting pool can have a longer timeout than the main one. QueryData applies the timeout of each pool.
+func (settings Settings) driverTimeout() time.Duration {
+	main, alerting := settings.queryTimeout(poolDefault), settings.queryTimeout(poolAlerting)
+	if main == 0 || alerting == 0 {
+		return 0
 	}
-	if jsonData["tlsMode"] != nil {
-		settings.TlsMode = jsonData["tlsMode"].(string)
+	return max(main, alerting)
+}
+
+// Endpoints returns the main server followed by the additional hosts, ordered by priority
+func (settings *Settings) Endpoints() []Host {
+	endpoints := []Host{{Server: settings.Server, Port: settings.Port}}
+	endpoints = append(endpoints, settings.Hosts...)
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].Priority < endpoints[j].Priority
+	})
+	return endpoints
+}
+
+// LoadSettings will read and validate Settings from the DataSourceConfig.
+// Numeric values may be given as numbers or strings. All the invalid values are reported at once as SettingsErrors.
+func LoadSettings(config backend.DataSourceInstanceSettings) (settings Settings, err error) {
+	var jsonData map[string]interface{}
+	if err := json.Unmarshal(config.JSONData, &jsonData); err != nil {
+		return settings, SettingsErrors{newSettingsError("jsonData", fmt.Errorf("%s: %w", err.Error(), ErrorMessageInvalidJSON))}
 	}
 
-	if jsonData["tlsClientCertFile"] != nil {
-		settings.TlsClientCertFile = jsonData["tlsClientCertFile"].(string)
+	d := settingsDecoder{jsonData: jsonData}
+	d.string("server", &settings.Server)
+	d.int("port", &settings.Port)
+	d.string("username", &settings.Username)
+	d.int("timeout", &settings.Timeout)
+	d.int("queryTimeout", &settings.QueryTimeout)
+
+	settings.Password = config.DecryptedSecureJSONData["password"]
+	settings.TlsCACert = config.DecryptedSecureJSONData["tlsCACert"]
+	settings.TlsClientCert = config.DecryptedSecureJSONData["tlsClientCert"]
+	settings.TlsClientKey = config.DecryptedSecureJSONData["tlsClientKey"]
+	settings.SshPrivateKey = config.DecryptedSecureJSONData["sshPrivateKey"]
+	settings.SshPassphrase = config.DecryptedSecureJSONData["sshPassphrase"]
+	settings.HttpToken = config.DecryptedSecureJSONData["httpToken"]
+
+	d.string("tlsConfigurationMethod", &settings.ConfigurationMethod)
+	d.string("tlsMode", &settings.TlsMode)
+	d.string("tlsServerName", &settings.TlsServerName)
+	d.string("tlsMinVersion", &settings.TlsMinVersion)
+	d.string("tlsCACertFile", &settings.TlsCACertFile)
+	d.string("tlsClientCertFile", &settings.TlsClientCertFile)
+	d.string("tlsClientKeyFile", &settings.TlsClientKeyFile)
+
+	d.bool("enableSecureSocksProxy", &settings.EnableSecureSocksProxy)
+	d.string("driver", &settings.Driver)
+	d.string("transport", &settings.Transport)
+	d.int("maxOpenConnections", &settings.MaxOpenConnections)
+	d.int("maxIdleConnections", &settings.MaxIdleConnections)
+	d.int("maxConnectionLifetime", &settings.MaxConnectionLifetime)
+	d.string("timeInterval", &settings.TimeInterval)
+
+	d.bool("disableKeepAlive", &settings.DisableKeepAlive)
+	d.int("keepAliveIdle", &settings.KeepAliveIdle)
+	d.int("keepAliveInterval", &settings.KeepAliveInterval)
+	d.int("keepAliveCount", &settings.KeepAliveCount)
+
+	d.hosts("hosts", &settings.Hosts)
+	d.int("hostProbeInterval", &settings.HostProbeInterval)
+
+	d.bool("enableSshTunnel", &settings.EnableSshTunnel)
+	d.string("sshHost", &settings.SshHost)
+	d.int("sshPort", &settings.SshPort)
+	d.string("sshUser", &settings.SshUser)
+	d.string("sshKnownHosts", &settings.SshKnownHosts)
+
+	d.int("retryMaxAttempts", &settings.RetryMaxAttempts)
+	d.int("retryBackoff", &settings.RetryBackoff)
+	d.int("retryMaxBackoff", &settings.RetryMaxBackoff)
+	d.int("retryJitter", &settings.RetryJitter)
+
+	d.int("cacheTTL", &settings.CacheTTL)
+	d.int("cacheMaxMemory", &settings.CacheMaxMemory)
+
+	d.bool("enableIncrementalRefresh", &settings.EnableIncrementalRefresh)
+	d.int("incrementalRefreshOverlap", &settings.IncrementalRefreshOverlap)
+
+	d.int("streamPollInterval", &settings.StreamPollInterval)
+	d.int("streamMaxRows", &settings.StreamMaxRows)
+
+	d.int("schemaCacheTTL", &settings.SchemaCacheTTL)
+
+	d.customSettings("customSettings", &settings.CustomSettings)
+	d.strings("initStatements", &settings.InitStatements)
+
+	d.bool("enableAlertingPool", &settings.EnableAlertingPool)
+	d.string("alertingServer", &settings.AlertingServer)
+	d.int("alertingPort", &settings.AlertingPort)
+	d.int("alertingTimeout", &settings.AlertingTimeout)
+	d.int("alertingQueryTimeout", &settings.AlertingQueryTimeout)
+	d.int("alertingMaxOpenConnections", &settings.AlertingMaxOpenConnections)
+	d.int("alertingMaxIdleConnections", &settings.AlertingMaxIdleConnections)
+	d.int("alertingMaxConnectionLifetime", &settings.AlertingMaxConnectionLifetime)
+
+	// values that could not be decoded are not validated again
+	var invalid SettingsErrors
+	errors.As(settings.isValid(), &invalid)
+	for _, e := range invalid {
+		if !d.errs.has(e.Field) {
+			d.errs = append(d.errs, e)
+		}
 	}
-	if jsonData["tlsClientKeyFile"] != nil {
-		settings.TlsClientKeyFile = jsonData["tlsClientKeyFile"].(string)
+	return settings, d.errs.orNil()
+}
+
+// settingsDecoder reads typed values from the json data, collecting the invalid ones instead of panicking
+type settingsDecoder struct {
+	jsonData map[string]interface{}
+	errs     SettingsErrors
+}
+
+func (d *settingsDecoder) string(field string, value *string) {
+	switch v := d.jsonData[field].(type) {
+	case nil:
+	case string:
+		*value = v
+	default:
+		d.errs.add(field, fmt.Errorf("expected a string, got %v: %w", v, ErrorMessageInvalidSettingType))
 	}
+}
 
-	if jsonData["enableSecureSocksProxy"] != nil {
-		settings.EnableSecureSocksProxy = jsonData["enableSecureSocksProxy"].(bool)
+func (d *settingsDecoder) bool(field string, value *bool) {
+	switch v := d.jsonData[field].(type) {
+	case nil:
+	case bool:
+		*value = v
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			d.errs.add(field, fmt.Errorf("expected a boolean, got %q: %w", v, ErrorMessageInvalidSettingType))
+			return
+		}
+		*value = b
+	default:
+		d.errs.add(field, fmt.Errorf("expected a boolean, got %v: %w", v, ErrorMessageInvalidSettingType))
+	}
+}
+
+func (d *settingsDecoder) int(field string, value *int64) {
+	if d.jsonData[field] == nil {
+		return
+	}
+	i, err := parseInt(d.jsonData[field])
+	if err != nil {
+		d.errs.add(field, err)
+		return
 	}
+	*value = i
+}
 
-	if jsonData["maxOpenConnections"] != nil {
-		if maxOpenConnections, ok := jsonData["maxOpenConnections"].(string); ok {
-			settings.MaxOpenConnections, err = strconv.ParseInt(maxOpenConnections, 0, 64)
-			if err != nil {
-				return settings, fmt.Errorf("could not parse maxOpenConnections value: %w", err)
+func (d *settingsDecoder) hosts(field string, value *[]Host) {
+	if d.jsonData[field] == nil {
+		return
+	}
+	hosts, ok := d.jsonData[field].([]interface{})
+	if !ok {
+		d.errs.add(field, fmt.Errorf("expected a list of hosts: %w", ErrorMessageInvalidHost))
+		return
+	}
+	for i, h := range hosts {
+		fields, ok := h.(map[string]interface{})
+		if !ok {
+			d.errs.add(fmt.Sprintf("%s[%d]", field, i), fmt.Errorf("expected a host: %w", ErrorMessageInvalidHost))
+			continue
+		}
+		host := settingsDecoder{jsonData: fields}
+		var h Host
+		host.string("server", &h.Server)
+		h.Server = strings.TrimSpace(h.Server)
+		host.int("port", &h.Port)
+		host.int("priority", &h.Priority)
+		if len(host.errs) > 0 {
+			for _, e := range host.errs {
+				e.Field = fmt.Sprintf("%s[%d].%s", field, i, e.Field)
+				d.errs = append(d.errs, e)
 			}
-		} else {
-			settings.MaxOpenConnections = int64(jsonData["maxOpenConnections"].(float64))
+			continue
 		}
+		*value = append(*value, h)
 	}
+}
 
-	if jsonData["maxIdleConnections"] != nil {
-		if maxIdleConnections, ok := jsonData["maxIdleConnections"].(string); ok {
-			settings.MaxIdleConnections, err = strconv.ParseInt(maxIdleConnections, 0, 64)
-			if err != nil {
-				return settings, fmt.Errorf("could not parse maxIdleConnections value: %w", err)
-			}
-		} else {
-			settings.MaxIdleConnections = int64(jsonData["maxIdleConnections"].(float64))
+func (d *settingsDecoder) strings(field string, value *[]string) {
+	if d.jsonData[field] == nil {
+		return
+	}
+	values, ok := d.jsonData[field].([]interface{})
+	if !ok {
+		d.errs.add(field, fmt.Errorf("expected a list of strings: %w", ErrorMessageInvalidSettingType))
+		return
+	}
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			d.errs.add(fmt.Sprintf("%s[%d]", field, i), fmt.Errorf("expected a string, got %v: %w", v, ErrorMessageInvalidSettingType))
+			continue
 		}
+		*value = append(*value, s)
 	}
+}
 
-	if jsonData["maxConnectionLifetime"] != nil {
-		if maxConnectionLifetime, ok := jsonData["maxConnectionLifetime"].(string); ok {
-			settings.MaxConnectionLifetime, err = strconv.ParseInt(maxConnectionLifetime, 0, 64)
-			if err != nil {
-				return settings, fmt.Errorf("could not parse maxConnectionLifetime value: %w", err)
+func (d *settingsDecoder) customSettings(field string, value *[]CustomSetting) {
+	if d.jsonData[field] == nil {
+		return
+	}
+	settings, ok := d.jsonData[field].([]interface{})
+	if !ok {
+		d.errs.add(field, fmt.Errorf("expected a list of settings: %w", ErrorMessageInvalidSettingType))
+		return
+	}
+	for i, s := range settings {
+		fields, ok := s.(map[string]interface{})
+		if !ok {
+			d.errs.add(fmt.Sprintf("%s[%d]", field, i), fmt.Errorf("expected a setting: %w", ErrorMessageInvalidSettingType))
+			continue
+		}
+		setting := settingsDecoder{jsonData: fields}
+		var c CustomSetting
+		setting.string("setting", &c.Setting)
+		c.Setting = strings.TrimSpace(c.Setting)
+		setting.string("value", &c.Value)
+		if len(setting.errs) > 0 {
+			for _, e := range setting.errs {
+				e.Field = fmt.Sprintf("%s[%d].%s", field, i, e.Field)
+				d.errs = append(d.errs, e)
 			}
-		} else {
-			settings.MaxConnectionLifetime = int64(jsonData["maxConnectionLifetime"].(float64))
+			continue
 		}
+		*value = append(*value, c)
 	}
+}
 
-	if jsonData["timeInterval"] != nil {
-		if timeInterval, ok := jsonData["timeInterval"].(string); ok {
-			settings.TimeInterval = timeInterval
+// parseInt accepts whole numbers given either as json numbers or as strings
+func parseInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > math.MaxInt64 {
+			return 0, fmt.Errorf("expected an integer, got %v: %w", v, ErrorMessageInvalidSettingType)
 		}
+		return int64(v), nil
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected an integer, got %q: %w", v, ErrorMessageInvalidSettingType)
+		}
+		return i, nil
+	default:
+		return 0, fmt.Errorf("expected an integer, got %v: %w", v, ErrorMessageInvalidSettingType)
 	}
-
-	return settings, settings.isValid()
 }
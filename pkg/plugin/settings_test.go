@@ -8,6 +8,7 @@ import (
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadSettings(t *testing.T) {
@@ -81,7 +82,7 @@ func TestLoadSettings(t *testing.T) {
 				name: "should converting string values to the correct type",
 				args: args{
 					config: backend.DataSourceInstanceSettings{
-						JSONData:                []byte(`{"server": "test", "username": "u", "port": "1234", "timeout": 15, "queryTimeout": 25, "maxOpenConnections": 10, "maxIdleConnections": 5, "maxConnectionLifetime": 3600   }`),
+						JSONData:                []byte(`{"server": "test", "username": "u", "port": "1234", "timeout": 15, "queryTimeout": 25, "maxOpenConnections": 10, "maxIdleConnections": 5, "maxConnectionLifetime": 3600, "driver": "pgx"   }`),
 						DecryptedSecureJSONData: map[string]string{"password": "p"},
 					},
 				},
@@ -95,6 +96,78 @@ func TestLoadSettings(t *testing.T) {
 					MaxOpenConnections:    10,
 					MaxIdleConnections:    5,
 					MaxConnectionLifetime: 3600,
+					Driver:                "pgx",
+				},
+				expectedErr: nil,
+			},
+			{
+				name: "should accept numbers and booleans as strings",
+				args: args{
+					config: backend.DataSourceInstanceSettings{
+						JSONData: []byte(`{"server": "test", "username": "u", "port": 8812, "queryTimeout": "50", "enableSecureSocksProxy": "true", "maxOpenConnections": " 10 ", "keepAliveIdle": "30", "disableKeepAlive": false,
+											"customSettings": [{"setting": "statement_timeout", "value": "10s"}], "initStatements": ["SELECT 1"] }`),
+						DecryptedSecureJSONData: map[string]string{"password": "p"},
+					},
+				},
+				expectedSettings: Settings{
+					Server:                 "test",
+					Port:                   8812,
+					Username:               "u",
+					Password:               "p",
+					QueryTimeout:           50,
+					EnableSecureSocksProxy: true,
+					MaxOpenConnections:     10,
+					KeepAliveIdle:          30,
+					CustomSettings:         []CustomSetting{{Setting: "statement_timeout", Value: "10s"}},
+					InitStatements:         []string{"SELECT 1"},
+				},
+				expectedErr: nil,
+			},
+			{
+				name: "should parse additional hosts",
+				args: args{
+					config: backend.DataSourceInstanceSettings{
+						JSONData: []byte(`{"server": "primary", "username": "u", "port": 8812, "hostProbeInterval": "10",
+											"hosts": [{"server": "replica1", "port": 8813, "priority": 1}, {"server": "replica2", "port": "8814", "priority": "1"}] }`),
+						DecryptedSecureJSONData: map[string]string{"password": "p"},
+					},
+				},
+				expectedSettings: Settings{
+					Server:   "primary",
+					Port:     8812,
+					Username: "u",
+					Password: "p",
+					Hosts: []Host{
+						{Server: "replica1", Port: 8813, Priority: 1},
+						{Server: "replica2", Port: 8814, Priority: 1},
+					},
+					HostProbeInterval: 10,
+				},
+				expectedErr: nil,
+			},
+			{
+				name: "should parse alerting pool",
+				args: args{
+					config: backend.DataSourceInstanceSettings{
+						JSONData: []byte(`{"server": "test", "username": "u", "port": 8812, "enableAlertingPool": true, "alertingServer": "replica",
+											"alertingPort": "8813", "alertingTimeout": 5, "alertingQueryTimeout": "30", "alertingMaxOpenConnections": 4,
+											"alertingMaxIdleConnections": 2, "alertingMaxConnectionLifetime": 600 }`),
+						DecryptedSecureJSONData: map[string]string{"password": "p"},
+					},
+				},
+				expectedSettings: Settings{
+					Server:                        "test",
+					Port:                          8812,
+					Username:                      "u",
+					Password:                      "p",
+					EnableAlertingPool:            true,
+					AlertingServer:                "replica",
+					AlertingPort:                  8813,
+					AlertingTimeout:               5,
+					AlertingQueryTimeout:          30,
+					AlertingMaxOpenConnections:    4,
+					AlertingMaxIdleConnections:    2,
+					AlertingMaxConnectionLifetime: 600,
 				},
 				expectedErr: nil,
 			},
@@ -119,6 +192,28 @@ func TestLoadSettings(t *testing.T) {
 			{jsonData: `{ "server": "", "port": 123 }`, password: "", wantErr: ErrorMessageInvalidServerName, description: "should capture empty server name"},
 			{jsonData: `{ "server": "foo" }`, password: "", wantErr: ErrorMessageInvalidPort, description: "should capture nil port"},
 			{jsonData: `  "server": "foo", "port": 443, "username" : "foo" }`, password: "", wantErr: ErrorMessageInvalidJSON, description: "should capture invalid json"},
+			{jsonData: `{ "server": 123, "port": 443, "username": "foo" }`, password: "bar", wantErr: ErrorMessageInvalidSettingType, description: "should capture server of the wrong type"},
+			{jsonData: `{ "server": "foo", "port": 443.5, "username": "foo" }`, password: "bar", wantErr: ErrorMessageInvalidSettingType, description: "should capture fractional port"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "enableSecureSocksProxy": "yes" }`, password: "bar", wantErr: ErrorMessageInvalidSettingType, description: "should capture invalid boolean"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "hosts": [{"server": "bar", "port": "x"}] }`, password: "bar", wantErr: ErrorMessageInvalidSettingType, description: "should capture invalid host port"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "customSettings": [{"setting": "a b", "value": "1"}] }`, password: "bar", wantErr: ErrorMessageInvalidCustomSetting, description: "should capture invalid custom setting"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "initStatements": ["SELECT 1; SELECT 2"] }`, password: "bar", wantErr: ErrorMessageInvalidInitStatement, description: "should capture multiple init statements"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "initStatements": "SELECT 1" }`, password: "bar", wantErr: ErrorMessageInvalidSettingType, description: "should capture init statements that are not a list"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "keepAliveInterval": -5 }`, password: "bar", wantErr: ErrorMessageInvalidKeepAlive, description: "should capture negative keepalive interval"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "retryMaxAttempts": 3, "retryBackoff": -100 }`, password: "bar", wantErr: ErrorMessageInvalidRetryPolicy, description: "should capture negative retry backoff"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "cacheTTL": 30, "cacheMaxMemory": -1 }`, password: "bar", wantErr: ErrorMessageInvalidCache, description: "should capture negative cache memory"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "enableIncrementalRefresh": true, "incrementalRefreshOverlap": -10 }`, password: "bar", wantErr: ErrorMessageInvalidIncrementalRefresh, description: "should capture negative incremental refresh overlap"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "streamMaxRows": -1 }`, password: "bar", wantErr: ErrorMessageInvalidStream, description: "should capture negative stream rows"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "schemaCacheTTL": -1 }`, password: "bar", wantErr: ErrorMessageInvalidSchemaCache, description: "should capture negative schema cache TTL"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "driver": "odbc" }`, password: "bar", wantErr: ErrorMessageInvalidDriver, description: "should capture unknown driver"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "transport": "grpc" }`, password: "bar", wantErr: ErrorMessageInvalidTransport, description: "should capture unknown transport"},
+			{jsonData: `{ "server": "foo", "port": 9000, "username": "foo", "transport": "http", "initStatements": ["SET a = 1"] }`, password: "bar", wantErr: ErrorMessageHttpSession, description: "should capture session statements over http"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "hosts": [{"port": 443}] }`, password: "bar", wantErr: ErrorMessageInvalidHost, description: "should capture host without server"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "hosts": [{"server": "bar", "priority": -1, "port": 443}] }`, password: "bar", wantErr: ErrorMessageInvalidHost, description: "should capture negative host priority"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "hosts": [{"server": "foo", "port": 443, "priority": 1}] }`, password: "bar", wantErr: ErrorMessageDuplicateHost, description: "should capture duplicate host"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "hosts": "bar" }`, password: "bar", wantErr: ErrorMessageInvalidHost, description: "should capture invalid hosts"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "enableAlertingPool": true, "alertingServer": "bar" }`, password: "bar", wantErr: ErrorMessageInvalidAlertingPort, description: "should capture alerting server without port"},
+			{jsonData: `{ "server": "foo", "port": 443, "username": "foo", "enableAlertingPool": true, "alertingMaxOpenConnections": -1 }`, password: "bar", wantErr: ErrorMessageInvalidAlertingPool, description: "should capture negative alerting pool limits"},
 		}
 		for i, tc := range tests {
 			t.Run(fmt.Sprintf("[%v/%v] %s", i+1, len(tests), tc.description), func(t *testing.T) {
@@ -133,3 +228,43 @@ func TestLoadSettings(t *testing.T) {
 		}
 	})
 }
+
+func TestEndpoints(t *testing.T) {
+	settings := Settings{
+		Server: "primary",
+		Port:   8812,
+		Hosts: []Host{
+			{Server: "replica2", Port: 8812, Priority: 2},
+			{Server: "replica1", Port: 8812, Priority: 1},
+			{Server: "balanced", Port: 8812, Priority: 0},
+		},
+	}
+	assert.Equal(t, []Host{
+		{Server: "primary", Port: 8812, Priority: 0},
+		{Server: "balanced", Port: 8812, Priority: 0},
+		{Server: "replica1", Port: 8812, Priority: 1},
+		{Server: "replica2", Port: 8812, Priority: 2},
+	}, settings.Endpoints())
+}
+
+func TestLoadSettingsErrors(t *testing.T) {
+	_, err := LoadSettings(backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{ "server": 123, "port": "abc", "queryTimeout": true, "hosts": [{"server": "bar", "port": 1}, {"port": 2}] }`),
+	})
+	var settingsErrors SettingsErrors
+	require.True(t, errors.As(err, &settingsErrors))
+
+	fields := map[string]string{}
+	for _, e := range settingsErrors {
+		fields[e.Field] = e.Reason
+	}
+	assert.Len(t, fields, 6)
+	assert.Contains(t, fields["server"], "expected a string")
+	assert.Contains(t, fields["port"], `expected an integer, got "abc"`)
+	assert.Contains(t, fields["queryTimeout"], "expected an integer")
+	assert.Contains(t, fields, "username")
+	assert.Contains(t, fields, "password")
+	assert.Contains(t, fields, "hosts[1]")
+	assert.ErrorIs(t, err, ErrorMessageInvalidUserName)
+	assert.ErrorIs(t, err, ErrorMessageInvalidHost)
+}
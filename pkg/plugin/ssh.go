@@ -0,0 +1,293 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+)
+
+const defaultSshPort = 22
+
+// sshAddress returns the address of the SSH bastion
+func (settings *Settings) sshAddress() string {
+	port := settings.SshPort
+	if port == 0 {
+		port = defaultSshPort
+	}
+	return net.JoinHostPort(settings.SshHost, strconv.FormatInt(port, 10))
+}
+
+// validateSshTunnel checks the SSH tunnel settings, the host key of the bastion must be pinned
+func (settings *Settings) validateSshTunnel() (errs SettingsErrors) {
+	if !settings.EnableSshTunnel {
+		return nil
+	}
+	if settings.SshHost == "" {
+		errs.add("sshHost", ErrorMessageInvalidSshHost)
+	}
+	if settings.SshPort < 0 {
+		errs.add("sshPort", ErrorMessageInvalidSshHost)
+	}
+	if settings.SshUser == "" {
+		errs.add("sshUser", ErrorMessageInvalidSshUser)
+	}
+	if _, err := settings.sshSigner(); err != nil {
+		errs.add("sshPrivateKey", err)
+	}
+	if _, err := parseKnownHosts(settings.SshKnownHosts); err != nil {
+		errs.add("sshKnownHosts", err)
+	}
+	return errs
+}
+
+func (settings *Settings) sshSigner() (ssh.Signer, error) {
+	if settings.SshPrivateKey == "" {
+		return nil, ErrorMessageInvalidSshKey
+	}
+	var signer ssh.Signer
+	var err error
+	if settings.SshPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(settings.SshPrivateKey), []byte(settings.SshPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey([]byte(settings.SshPrivateKey))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrorMessageInvalidSshKey)
+	}
+	return signer, nil
+}
+
+// knownHost - host key of the known_hosts format
+type knownHost struct {
+	revoked bool
+	hosts   []string
+	key     ssh.PublicKey
+}
+
+func parseKnownHosts(content string) ([]knownHost, error) {
+	var entries []knownHost
+	rest := []byte(content)
+	for {
+		marker, hosts, key, _, next, err := ssh.ParseKnownHosts(rest)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("%s: %w", err.Error(), ErrorMessageInvalidSshKnownHosts)
+		}
+		if marker != "" && marker != "revoked" {
+			return nil, fmt.Errorf("unsupported marker @%s: %w", marker, ErrorMessageInvalidSshKnownHosts)
+		}
+		entries = append(entries, knownHost{revoked: marker == "revoked", hosts: hosts, key: key})
+		rest = next
+	}
+	if len(entries) == 0 {
+		return nil, ErrorMessageInvalidSshKnownHosts
+	}
+	return entries, nil
+}
+
+var knownHostEscaper = strings.NewReplacer("[", `\[`, "]", `\]`)
+
+// matchKnownHost matches a host pattern of the known_hosts format, either hashed, plain or with wildcards
+func matchKnownHost(pattern, address string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[3:], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(address))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	// brackets enclose host names with a non-default port, they are not character classes
+	matched, err := path.Match(knownHostEscaper.Replace(pattern), address)
+	return err == nil && matched
+}
+
+// matchKnownHosts matches the host patterns of a known_hosts entry. The address must match a pattern and none of
+// the negated !patterns.
+func matchKnownHosts(patterns []string, address string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchKnownHost(negated, address) {
+				return false
+			}
+		} else if !matched {
+			matched = matchKnownHost(pattern, address)
+		}
+	}
+	return matched
+}
+
+// hostKeyCallback accepts only the host keys pinned in the known hosts
+func hostKeyCallback(entries []knownHost) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		address := knownhosts.Normalize(hostname)
+		for _, entry := range entries {
+			if !bytes.Equal(entry.key.Marshal(), key.Marshal()) {
+				continue
+			}
+			if entry.revoked {
+				return fmt.Errorf("SSH host key of %s is revoked", hostname)
+			}
+			if matchKnownHosts(entry.hosts, address) {
+				return nil
+			}
+		}
+		return fmt.Errorf("SSH host key of %s is not a known host key (%s %s)", hostname, key.Type(), ssh.FingerprintSHA256(key))
+	}
+}
+
+// sshTunnel dials through an SSH bastion. The SSH connection is shared by all the connections
+// of the pool and is established again when it drops.
+type sshTunnel struct {
+	address string
+	config  *ssh.ClientConfig
+	dialer  proxy.ContextDialer
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+func newSshTunnel(settings Settings, dialer proxy.ContextDialer) (*sshTunnel, error) {
+	signer, err := settings.sshSigner()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseKnownHosts(settings.SshKnownHosts)
+	if err != nil {
+		return nil, err
+	}
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	return &sshTunnel{
+		address: settings.sshAddress(),
+		config: &ssh.ClientConfig{
+			User:            settings.SshUser,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback(entries),
+			Timeout:         time.Duration(settings.Timeout) * time.Second,
+		},
+		dialer: dialer,
+	}, nil
+}
+
+// connect returns the SSH client, establishing the SSH connection when there is none
+func (t *sshTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, errors.New("SSH tunnel is closed")
+	}
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	conn, err := t.dialer.DialContext(ctx, "tcp", t.address)
+	if err != nil {
+		return nil, fmt.Errorf("SSH tunnel connection to %s failed: %w", t.address, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, channels, requests, err := ssh.NewClientConn(conn, t.address, t.config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("SSH tunnel handshake with %s failed: %w", t.address, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	client := ssh.NewClient(c, channels, requests)
+	t.client = client
+	log.DefaultLogger.Info("QuestDB SSH tunnel established", "bastion", t.address)
+	go func() {
+		err := client.Wait()
+		log.DefaultLogger.Warn("QuestDB SSH tunnel dropped", "bastion", t.address, "error", err)
+		t.drop(client)
+	}()
+	return client, nil
+}
+
+// drop forgets the given client, so that the next dial establishes a new SSH connection
+func (t *sshTunnel) drop(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client == client {
+		t.client = nil
+	}
+	_ = client.Close()
+}
+
+// Dial implements proxy.Dialer
+func (t *sshTunnel) Dial(network, address string) (net.Conn, error) {
+	return t.DialContext(context.Background(), network, address)
+}
+
+// DialContext implements proxy.ContextDialer. When the SSH connection turns out to be broken,
+// it is established again once before giving up.
+func (t *sshTunnel) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := t.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := client.DialContext(ctx, network, address)
+		if err == nil {
+			if trace := dialTraceFromContext(ctx); trace != nil {
+				trace.setSshTunnel()
+				if _, proxied := t.dialer.(*postgresProxyDialer); proxied {
+					trace.setProxy()
+				}
+			}
+			return conn, nil
+		}
+		// a rejected channel means that the bastion is fine but could not reach the address
+		var channelErr *ssh.OpenChannelError
+		if errors.As(err, &channelErr) || ctx.Err() != nil || attempt > 0 {
+			return nil, err
+		}
+		log.DefaultLogger.Debug("QuestDB SSH tunnel is broken, reconnecting", "bastion", t.address, "error", err)
+		t.drop(client)
+	}
+}
+
+// Close closes the SSH connection
+func (t *sshTunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.client == nil {
+		return nil
+	}
+	err := t.client.Close()
+	t.client = nil
+	return err
+}
@@ -0,0 +1,375 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshServer is an in-process stand-in for sshd, which only supports public key authentication and direct-tcpip channels
+type sshServer struct {
+	address   string
+	hostKey   ssh.Signer
+	handshake atomic.Int32
+
+	mu    sync.Mutex
+	conns []*ssh.ServerConn
+}
+
+func startSshServer(t *testing.T, authorized ssh.PublicKey) *sshServer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, assert.AnError
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	server := &sshServer{address: listener.Addr().String(), hostKey: hostKey}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func (s *sshServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	s.handshake.Add(1)
+	s.mu.Lock()
+	s.conns = append(s.conns, serverConn)
+	s.mu.Unlock()
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+		// host, port, origin host and origin port of RFC 4254
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			_ = upstream.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelRequests)
+		go func() {
+			defer channel.Close()
+			defer upstream.Close()
+			go func() { _, _ = io.Copy(upstream, channel) }()
+			_, _ = io.Copy(channel, upstream)
+		}()
+	}
+}
+
+// drop closes the SSH connections as if the network went down
+func (s *sshServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *sshServer) knownHosts() string {
+	return knownhosts.Line([]string{knownhosts.Normalize(s.address)}, s.hostKey.PublicKey())
+}
+
+// startEchoServer answers every connection with "ok" followed by what it receives
+func startEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = conn.Write([]byte("ok"))
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func newSshKey(t *testing.T) (string, ssh.PublicKey) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(block)), signer.PublicKey()
+}
+
+func sshSettings(server *sshServer, privateKey string) Settings {
+	host, port, _ := net.SplitHostPort(server.address)
+	p, _ := strconv.ParseInt(port, 10, 64)
+	return Settings{
+		Timeout:         5,
+		EnableSshTunnel: true,
+		SshHost:         host,
+		SshPort:         p,
+		SshUser:         "questdb",
+		SshKnownHosts:   server.knownHosts(),
+		SshPrivateKey:   privateKey,
+	}
+}
+
+func dialEcho(t *testing.T, tunnel *sshTunnel, address string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tunnel.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	response := make([]byte, 2)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return err
+	}
+	assert.Equal(t, "ok", string(response))
+
+	_, err = conn.Write([]byte{1, 2, 3, 4})
+	require.NoError(t, err)
+	echo := make([]byte, 4)
+	_, err = io.ReadFull(conn, echo)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0x01020304), binary.BigEndian.Uint32(echo))
+	return nil
+}
+
+func TestSshTunnel(t *testing.T) {
+	privateKey, publicKey := newSshKey(t)
+	server := startSshServer(t, publicKey)
+	echo := startEchoServer(t)
+
+	t.Run("should dial through the bastion and share the SSH connection", func(t *testing.T) {
+		tunnel, err := newSshTunnel(sshSettings(server, privateKey), nil)
+		require.NoError(t, err)
+		defer tunnel.Close()
+
+		before := server.handshake.Load()
+		require.NoError(t, dialEcho(t, tunnel, echo))
+		require.NoError(t, dialEcho(t, tunnel, echo))
+		assert.Equal(t, before+1, server.handshake.Load())
+	})
+
+	t.Run("should reconnect when the tunnel drops", func(t *testing.T) {
+		tunnel, err := newSshTunnel(sshSettings(server, privateKey), nil)
+		require.NoError(t, err)
+		defer tunnel.Close()
+
+		before := server.handshake.Load()
+		require.NoError(t, dialEcho(t, tunnel, echo))
+		server.drop()
+		require.NoError(t, dialEcho(t, tunnel, echo))
+		assert.Equal(t, before+2, server.handshake.Load())
+	})
+
+	t.Run("should report unreachable addresses without reconnecting", func(t *testing.T) {
+		tunnel, err := newSshTunnel(sshSettings(server, privateKey), nil)
+		require.NoError(t, err)
+		defer tunnel.Close()
+
+		before := server.handshake.Load()
+		var channelErr *ssh.OpenChannelError
+		assert.ErrorAs(t, dialEcho(t, tunnel, "127.0.0.1:1"), &channelErr)
+		assert.Equal(t, before+1, server.handshake.Load())
+	})
+
+	t.Run("should reject a host key that is not pinned", func(t *testing.T) {
+		other := startSshServer(t, publicKey)
+		settings := sshSettings(server, privateKey)
+		settings.SshKnownHosts = other.knownHosts()
+		tunnel, err := newSshTunnel(settings, nil)
+		require.NoError(t, err)
+		assert.ErrorContains(t, dialEcho(t, tunnel, echo), "not a known host key")
+	})
+
+	t.Run("should reject an unauthorized key", func(t *testing.T) {
+		otherKey, _ := newSshKey(t)
+		tunnel, err := newSshTunnel(sshSettings(server, otherKey), nil)
+		require.NoError(t, err)
+		assert.ErrorContains(t, dialEcho(t, tunnel, echo), "handshake")
+	})
+
+	t.Run("should fail once closed", func(t *testing.T) {
+		tunnel, err := newSshTunnel(sshSettings(server, privateKey), nil)
+		require.NoError(t, err)
+		require.NoError(t, tunnel.Close())
+		assert.Error(t, dialEcho(t, tunnel, echo))
+	})
+}
+
+func TestSshTunnelConnector(t *testing.T) {
+	privateKey, publicKey := newSshKey(t)
+	server := startSshServer(t, publicKey)
+	pki := newTestPKI(t, "localhost")
+	address := startSSLServer(t, 'N', pki.server)
+	host, port, _ := net.SplitHostPort(address)
+	p, _ := strconv.ParseInt(port, 10, 64)
+
+	for _, driver := range []string{driverPq, driverPgx} {
+		t.Run("should reach QuestDB through the tunnel with "+driver, func(t *testing.T) {
+			settings := sshSettings(server, privateKey)
+			settings.Server, settings.Port, settings.Username, settings.Password = host, p, "admin", "quest"
+			settings.TlsMode = "require"
+			settings.Driver = driver
+			tunnel, err := newSshTunnel(settings, nil)
+			require.NoError(t, err)
+			defer tunnel.Close()
+
+			before := server.handshake.Load()
+			connector, err := newHostConnector(settings, Host{Server: host, Port: p}, "version", tunnel)
+			require.NoError(t, err)
+			// the stand-in server refuses TLS/SSL, which proves that the request went through the tunnel
+			trace := &dialTrace{}
+			_, err = connector.Connect(withDialTrace(context.Background(), trace))
+			assert.Error(t, err)
+			assert.Equal(t, before+1, server.handshake.Load())
+			proxy, sshTunnel := trace.route()
+			assert.False(t, proxy)
+			assert.True(t, sshTunnel)
+		})
+	}
+}
+
+func TestSshTunnelFailover(t *testing.T) {
+	privateKey, publicKey := newSshKey(t)
+	server := startSshServer(t, publicKey)
+	pki := newTestPKI(t, "localhost")
+	replica := startSSLServer(t, 'N', pki.server)
+	// the bastion can't reach the primary, its port is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	primary := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	for _, driver := range []string{driverPq, driverPgx} {
+		t.Run("should fail over to the replica behind the tunnel with "+driver, func(t *testing.T) {
+			settings := sshSettings(server, privateKey)
+			settings.Username, settings.Password = "admin", "quest"
+			settings.TlsMode = "require"
+			settings.Driver = driver
+			tunnel, err := newSshTunnel(settings, nil)
+			require.NoError(t, err)
+			defer tunnel.Close()
+
+			var endpoints []*endpoint
+			for i, address := range []string{primary, replica} {
+				host, port, _ := net.SplitHostPort(address)
+				p, _ := strconv.ParseInt(port, 10, 64)
+				h := Host{Server: host, Port: p, Priority: int64(i)}
+				connector, err := newHostConnector(settings, h, "version", tunnel)
+				require.NoError(t, err)
+				endpoints = append(endpoints, &endpoint{host: h, connector: connector})
+			}
+			failover := newFailoverConnector(endpoints, 0)
+			defer failover.Close()
+
+			// the stand-in replica refuses TLS/SSL, which proves that it was reached after the primary
+			_, err = failover.Connect(context.Background())
+			require.Error(t, err)
+			var channelErr *ssh.OpenChannelError
+			assert.False(t, errors.As(err, &channelErr), err.Error())
+			assert.True(t, endpoints[0].isDown())
+			assert.False(t, endpoints[1].isDown())
+		})
+	}
+}
+
+func TestSshTunnelSettings(t *testing.T) {
+	privateKey, publicKey := newSshKey(t)
+	server := startSshServer(t, publicKey)
+
+	settings := sshSettings(server, privateKey)
+	assert.Empty(t, settings.validateSshTunnel())
+
+	settings.SshPort = 0
+	assert.Equal(t, net.JoinHostPort(settings.SshHost, "22"), settings.sshAddress())
+
+	invalid := Settings{EnableSshTunnel: true, SshPrivateKey: "key", SshKnownHosts: "bastion ssh-ed25519 invalid"}
+	errs := invalid.validateSshTunnel()
+	fields := map[string]error{}
+	for _, e := range errs {
+		fields[e.Field] = e
+	}
+	assert.ErrorIs(t, fields["sshHost"], ErrorMessageInvalidSshHost)
+	assert.ErrorIs(t, fields["sshUser"], ErrorMessageInvalidSshUser)
+	assert.ErrorIs(t, fields["sshPrivateKey"], ErrorMessageInvalidSshKey)
+	assert.ErrorIs(t, fields["sshKnownHosts"], ErrorMessageInvalidSshKnownHosts)
+
+	disabled := Settings{SshHost: ""}
+	assert.Empty(t, disabled.validateSshTunnel())
+}
+
+func TestMatchKnownHost(t *testing.T) {
+	assert.True(t, matchKnownHost("bastion", "bastion"))
+	assert.True(t, matchKnownHost("*.internal", "bastion.internal"))
+	assert.True(t, matchKnownHost("[bastion]:2222", "[bastion]:2222"))
+	assert.False(t, matchKnownHost("bastion", "[bastion]:2222"))
+	hashed := knownhosts.HashHostname("bastion")
+	assert.True(t, matchKnownHost(hashed, "bastion"))
+	assert.False(t, matchKnownHost(hashed, "other"))
+}
+
+func TestMatchKnownHosts(t *testing.T) {
+	assert.True(t, matchKnownHosts([]string{"*.internal", "!db.internal"}, "bastion.internal"))
+	assert.False(t, matchKnownHosts([]string{"*.internal", "!db.internal"}, "db.internal"))
+	assert.False(t, matchKnownHosts([]string{"!db.internal", "*.internal"}, "db.internal"))
+	assert.False(t, matchKnownHosts([]string{"!db.internal"}, "bastion.internal"))
+	assert.False(t, matchKnownHosts([]string{"bastion", "!*.internal"}, "other"))
+}
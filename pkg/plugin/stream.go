@@ -0,0 +1,324 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"github.com/grafana/grafana-plugin-sdk-go/live"
+	"github.com/grafana/sqlds/v4"
+	"github.com/questdb/grafana-questdb-datasource/pkg/converters"
+	"github.com/questdb/grafana-questdb-datasource/pkg/macros"
+)
+
+const (
+	defaultStreamPollInterval = time.Second
+	defaultStreamMaxRows      = 1000
+
+	streamPathPrefix = "stream/"
+
+	// streamRegistrationTTL is how long the channel of a streaming query can be subscribed to before it runs
+	streamRegistrationTTL = 10 * time.Minute
+)
+
+func (settings *Settings) validateStream() (errs SettingsErrors) {
+	if settings.StreamPollInterval < 0 {
+		errs.add("streamPollInterval", ErrorMessageInvalidStream)
+	}
+	if settings.StreamMaxRows < 0 {
+		errs.add("streamMaxRows", ErrorMessageInvalidStream)
+	}
+	return errs
+}
+
+// streamPollInterval returns how often the streams poll QuestDB for new rows
+func (settings *Settings) streamPollInterval() time.Duration {
+	if settings.StreamPollInterval == 0 {
+		return defaultStreamPollInterval
+	}
+	return time.Duration(settings.StreamPollInterval) * time.Millisecond
+}
+
+// streamMaxRows returns the maximum number of rows pushed at once
+func (settings *Settings) streamMaxRows() int64 {
+	if settings.StreamMaxRows == 0 {
+		return defaultStreamMaxRows
+	}
+	return settings.StreamMaxRows
+}
+
+// streamQuery - query of a Live channel, the new rows are those past the last seen timestamp, and those at the last
+// seen timestamp past the seen ones
+type streamQuery struct {
+	query      backend.DataQuery
+	timeColumn string
+	last       time.Time
+	seen       int
+
+	// expires is when the channel is forgotten unless it runs, running counts the RunStream calls of the channel
+	expires time.Time
+	running int
+}
+
+// streams - queries of the Live channels, registered by the queries marked as streaming. A channel is forgotten
+// when its last RunStream returns, or when it isn't run within streamRegistrationTTL.
+type streams struct {
+	mu      sync.Mutex
+	queries map[string]*streamQuery
+	now     func() time.Time
+}
+
+func newStreams() *streams {
+	return &streams{queries: map[string]*streamQuery{}, now: time.Now}
+}
+
+func (s *streams) get(path string) (*streamQuery, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query, ok := s.queries[path]
+	return query, ok
+}
+
+func (s *streams) set(path string, query *streamQuery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for p, q := range s.queries {
+		if q.running == 0 && now.After(q.expires) {
+			delete(s.queries, p)
+		}
+	}
+	if previous, ok := s.queries[path]; ok {
+		query.running = previous.running
+	}
+	query.expires = now.Add(streamRegistrationTTL)
+	s.queries[path] = query
+}
+
+// start returns the query of the channel and marks it as running
+func (s *streams) start(path string) (*streamQuery, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query, ok := s.queries[path]
+	if ok {
+		query.running++
+	}
+	return query, ok
+}
+
+// stop forgets the channel once it no longer runs, the query registers it again on its next response
+func (s *streams) stop(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if query, ok := s.queries[path]; ok {
+		if query.running--; query.running <= 0 {
+			delete(s.queries, path)
+		}
+	}
+}
+
+// isStreaming tells whether the query is marked as streaming
+func isStreaming(query backend.DataQuery) bool {
+	var model struct {
+		Stream bool `json:"stream"`
+	}
+	return json.Unmarshal(query.JSON, &model) == nil && model.Stream
+}
+
+// streamPath identifies the Live channel of a query by its SQL and its parameters
+func streamPath(query backend.DataQuery) (string, error) {
+	q, err := sqlds.GetQuery(query, nil, false)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	for _, part := range append([]string{q.RawSQL}, queryParameters(query)...) {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return streamPathPrefix + hex.EncodeToString(hash.Sum(nil)[:16]), nil
+}
+
+// stream registers the Live channel of a streaming query and adds it to the metadata of the frame, so that the panel
+// subscribes to it. The rows are streamed past the last timestamp of the first time field of the response.
+func (ds *Datasource) stream(req *backend.QueryDataRequest, query backend.DataQuery, response backend.DataResponse) {
+	if response.Error != nil || len(response.Frames) == 0 || req.PluginContext.DataSourceInstanceSettings == nil {
+		return
+	}
+	frame := response.Frames[0]
+	timeIndex := -1
+	for i, field := range frame.Fields {
+		if t := field.Type(); t == data.FieldTypeTime || t == data.FieldTypeNullableTime {
+			timeIndex = i
+			break
+		}
+	}
+	if timeIndex < 0 {
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: "The query cannot be streamed, it has no timestamp column"})
+		return
+	}
+	path, err := streamPath(query)
+	if err != nil {
+		return
+	}
+
+	last, seen := lastTimestamp(frame, frame.Fields[timeIndex].Name, time.Time{}, 0)
+	if last.IsZero() {
+		last = query.TimeRange.To
+	}
+	ds.streams.set(path, &streamQuery{query: query, timeColumn: frame.Fields[timeIndex].Name, last: last, seen: seen})
+
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	frame.Meta.Channel = live.Channel{
+		Scope:     live.ScopeDatasource,
+		Namespace: req.PluginContext.DataSourceInstanceSettings.UID,
+		Path:      path,
+	}.String()
+}
+
+// SubscribeStream implements backend.StreamHandler, only the channels of streaming queries can be subscribed to
+func (ds *Datasource) SubscribeStream(_ context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	if _, ok := ds.streams.get(req.Path); !ok || ds.settingsErrors != nil {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// PublishStream implements backend.StreamHandler, the channels are read only
+func (ds *Datasource) PublishStream(context.Context, *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+}
+
+// RunStream implements backend.StreamHandler. It polls QuestDB for the rows past the last seen timestamp and pushes
+// them to the channel, at most the configured number of rows at once.
+func (ds *Datasource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	stream, ok := ds.streams.start(req.Path)
+	if !ok {
+		return fmt.Errorf("unknown stream %s", req.Path)
+	}
+	defer ds.streams.stop(req.Path)
+	log.DefaultLogger.Debug("QuestDB stream started", "path", req.Path)
+	defer log.DefaultLogger.Debug("QuestDB stream stopped", "path", req.Path)
+
+	last, seen := stream.last, stream.seen
+	include := data.IncludeAll
+	ticker := time.NewTicker(ds.settings.streamPollInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		frame, err := ds.poll(ctx, stream, last, seen)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.DefaultLogger.Warn("QuestDB stream poll failed", "path", req.Path, "error", err)
+			continue
+		}
+		if frame.Rows() == 0 {
+			continue
+		}
+		last, seen = lastTimestamp(frame, stream.timeColumn, last, seen)
+		if err := sender.SendFrame(frame, include); err != nil {
+			return err
+		}
+		include = data.IncludeDataOnly
+	}
+}
+
+// poll returns the rows of the stream from the given timestamp, in timestamp order, without the rows already seen at
+// that timestamp. The rows at the last timestamp are fetched again, as the LIMIT may have cut through them.
+func (ds *Datasource) poll(ctx context.Context, stream *streamQuery, last time.Time, seen int) (*data.Frame, error) {
+	ctx, query := ds.driver.MutateQuery(ctx, stream.query)
+	q, err := sqlds.GetQuery(query, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	q.TimeRange = backend.TimeRange{From: last, To: time.Now()}
+	sql, err := sqlds.Interpolate(ds.driver, q)
+	if err != nil {
+		return nil, err
+	}
+	// the rows of TIMESTAMP_NS columns are compared with nanosecond timestamps, as in the time macros
+	since, err := macros.TimeLiteral(last, timeColumnType(ctx, ds.schema, q.RawSQL, stream.timeColumn))
+	if err != nil {
+		return nil, err
+	}
+	column := quoteIdentifier(stream.timeColumn)
+	maxRows := ds.settings.streamMaxRows() + int64(seen)
+	sql = fmt.Sprintf("SELECT * FROM (%s) WHERE %s >= %s ORDER BY %s LIMIT %d",
+		strings.TrimRight(strings.TrimSpace(sql), ";"), column, since, column, maxRows)
+
+	db, err := ds.GetDBFromQuery(ctx, &sqlds.Query{})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, sql, queryArgsFromContext(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	frame, err := sqlutil.FrameFromRows(rows, maxRows, converters.QdbConverters...)
+	if err != nil {
+		return nil, err
+	}
+	frame.RefID = stream.query.RefID
+	dropSeen(frame, stream.timeColumn, last, seen)
+	return frame, nil
+}
+
+// dropSeen removes the first rows at the last timestamp, up to the number of rows already seen at that timestamp
+func dropSeen(frame *data.Frame, column string, last time.Time, seen int) {
+	field, _ := frame.FieldByName(column)
+	if field == nil {
+		return
+	}
+	for ; seen > 0 && field.Len() > 0; seen-- {
+		if t, ok := field.ConcreteAt(0); !ok || !t.(time.Time).Equal(last) {
+			return
+		}
+		frame.DeleteRow(0)
+	}
+}
+
+// lastTimestamp returns the latest value of the time column with the number of rows at that value, or the given
+// timestamp and count when there is none. The count adds up when the latest value is the given timestamp.
+func lastTimestamp(frame *data.Frame, column string, last time.Time, seen int) (time.Time, int) {
+	field, _ := frame.FieldByName(column)
+	if field == nil {
+		return last, seen
+	}
+	for i := 0; i < field.Len(); i++ {
+		t, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		switch ts := t.(time.Time); {
+		case ts.After(last):
+			last, seen = ts, 1
+		case ts.Equal(last):
+			seen++
+		}
+	}
+	return last, seen
+}
+
+// quoteIdentifier quotes a column name for QuestDB
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamRegistration(t *testing.T) {
+	ds := &Datasource{streams: newStreams()}
+	req := &backend.QueryDataRequest{PluginContext: backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{UID: "questdb"},
+	}}
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	query := backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: start, To: start.Add(time.Hour)},
+		JSON:      []byte(`{"rawSql": "SELECT ts, price FROM trades WHERE $__timeFilter(ts)", "stream": true}`),
+	}
+	require.True(t, isStreaming(query))
+	assert.False(t, isStreaming(backend.DataQuery{JSON: []byte(`{"rawSql": "SELECT 1"}`)}))
+
+	frame := data.NewFrame("trades",
+		data.NewField("ts", nil, []time.Time{start.Add(time.Minute), start.Add(3 * time.Minute), start.Add(2 * time.Minute)}),
+		data.NewField("price", nil, []float64{1, 2, 3}))
+	ds.stream(req, query, backend.DataResponse{Frames: data.Frames{frame}})
+
+	path, err := streamPath(query)
+	require.NoError(t, err)
+	assert.Equal(t, "ds/questdb/"+path, frame.Meta.Channel)
+
+	stream, ok := ds.streams.get(path)
+	require.True(t, ok)
+	assert.Equal(t, "ts", stream.timeColumn)
+	assert.Equal(t, start.Add(3*time.Minute), stream.last)
+	assert.Equal(t, 1, stream.seen)
+
+	res, err := ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: path})
+	require.NoError(t, err)
+	assert.Equal(t, backend.SubscribeStreamStatusOK, res.Status)
+
+	res, err = ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: "stream/unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, backend.SubscribeStreamStatusNotFound, res.Status)
+
+	publish, err := ds.PublishStream(context.Background(), &backend.PublishStreamRequest{Path: path})
+	require.NoError(t, err)
+	assert.Equal(t, backend.PublishStreamStatusPermissionDenied, publish.Status)
+
+	err = ds.RunStream(context.Background(), &backend.RunStreamRequest{Path: "stream/unknown"}, nil)
+	assert.Error(t, err)
+
+	t.Run("should not stream queries without timestamp", func(t *testing.T) {
+		frame := data.NewFrame("count", data.NewField("count", nil, []int64{3}))
+		ds.stream(req, query, backend.DataResponse{Frames: data.Frames{frame}})
+		assert.Empty(t, frame.Meta.Channel)
+		require.Len(t, frame.Meta.Notices, 1)
+	})
+
+	t.Run("should stream from the end of the time range without rows", func(t *testing.T) {
+		empty := data.NewFrame("trades", data.NewField("ts", nil, []time.Time{}))
+		ds.stream(req, query, backend.DataResponse{Frames: data.Frames{empty}})
+		stream, _ := ds.streams.get(path)
+		assert.Equal(t, start.Add(time.Hour), stream.last)
+	})
+}
+
+func TestStreamTies(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	frame := func(minutes ...int) *data.Frame {
+		values := make([]time.Time, 0, len(minutes))
+		for _, m := range minutes {
+			values = append(values, start.Add(time.Duration(m)*time.Minute))
+		}
+		return data.NewFrame("trades", data.NewField("ts", nil, values))
+	}
+
+	// the LIMIT cut through the rows at minute 2, two of them were sent
+	last, seen := lastTimestamp(frame(1, 2, 2), "ts", time.Time{}, 0)
+	assert.Equal(t, start.Add(2*time.Minute), last)
+	assert.Equal(t, 2, seen)
+
+	// the next poll fetches the rows from minute 2 again
+	next := frame(2, 2, 2, 3)
+	dropSeen(next, "ts", last, seen)
+	require.Equal(t, 2, next.Rows())
+	assert.Equal(t, start.Add(2*time.Minute), next.Fields[0].At(0))
+
+	last, seen = lastTimestamp(frame(2), "ts", last, seen)
+	assert.Equal(t, start.Add(2*time.Minute), last)
+	assert.Equal(t, 3, seen)
+
+	// rows past the last timestamp are never dropped
+	later := frame(3, 4)
+	dropSeen(later, "ts", last, seen)
+	assert.Equal(t, 2, later.Rows())
+}
+
+func TestStreamExpiration(t *testing.T) {
+	s := newStreams()
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	s.set("stream/a", &streamQuery{})
+	s.set("stream/b", &streamQuery{})
+	_, ok := s.start("stream/b")
+	require.True(t, ok)
+
+	t.Run("should forget the channels that don't run", func(t *testing.T) {
+		now = now.Add(streamRegistrationTTL + time.Second)
+		s.set("stream/c", &streamQuery{})
+		_, ok := s.get("stream/a")
+		assert.False(t, ok)
+		_, ok = s.get("stream/b")
+		assert.True(t, ok)
+	})
+
+	t.Run("should forget the channels once they stop", func(t *testing.T) {
+		s.set("stream/b", &streamQuery{})
+		_, ok := s.start("stream/b")
+		require.True(t, ok)
+		s.stop("stream/b")
+		_, ok = s.get("stream/b")
+		assert.True(t, ok)
+		s.stop("stream/b")
+		_, ok = s.get("stream/b")
+		assert.False(t, ok)
+	})
+}
+
+func TestStreamSettings(t *testing.T) {
+	settings := Settings{}
+	assert.Equal(t, defaultStreamPollInterval, settings.streamPollInterval())
+	assert.Equal(t, int64(defaultStreamMaxRows), settings.streamMaxRows())
+
+	settings = Settings{StreamPollInterval: 250, StreamMaxRows: 10}
+	assert.Equal(t, 250*time.Millisecond, settings.streamPollInterval())
+	assert.Equal(t, int64(10), settings.streamMaxRows())
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, `"ts"`, quoteIdentifier("ts"))
+	assert.Equal(t, `"a""b"`, quoteIdentifier(`a"b`))
+}
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+var (
+	timeZoneMacro      = regexp.MustCompile(`\$__timezone\b`)
+	sampleByAlignMacro = regexp.MustCompile(`\$__sampleByAlign\b`)
+	// alignToTimeZone matches the ALIGN TO CALENDAR TIME ZONE clauses, with the time zone when there is one
+	alignToTimeZone = regexp.MustCompile(`(?i)\bALIGN\s+TO\s+CALENDAR\s+TIME\s+ZONE\b(\s*')?`)
+	// timeZoneName matches the IANA names and the offsets of time zones, so that they can be quoted safely
+	timeZoneName = regexp.MustCompile(`^[A-Za-z0-9_+\-/:]+$`)
+)
+
+// setTimeZone applies the time zone of the dashboard to the rawSql: $__timezone is replaced by the time zone as a
+// string literal, $__sampleByAlign by the clause aligning the SAMPLE BY buckets to the calendar of the time zone, and
+// the ALIGN TO CALENDAR TIME ZONE clauses without a time zone get it. Without a time zone, or with an invalid one,
+// the query is left to the macros, which fall back to UTC.
+func setTimeZone(query json.RawMessage, timeZone string) (json.RawMessage, bool, error) {
+	timeZone = normalizeTimeZone(timeZone)
+	if timeZone == "" {
+		return query, false, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(query, &fields); err != nil {
+		return query, false, err
+	}
+	var rawSQL string
+	if err := json.Unmarshal(fields["rawSql"], &rawSQL); err != nil {
+		return query, false, nil
+	}
+
+	literal := quoteLiteral(timeZone)
+	sql := timeZoneMacro.ReplaceAllLiteralString(rawSQL, literal)
+	sql = sampleByAlignMacro.ReplaceAllLiteralString(sql, "ALIGN TO CALENDAR TIME ZONE "+literal)
+	sql = alignToTimeZone.ReplaceAllStringFunc(sql, func(clause string) string {
+		if strings.HasSuffix(clause, "'") {
+			return clause
+		}
+		return clause + " " + literal
+	})
+	if sql == rawSQL {
+		return query, false, nil
+	}
+
+	fields["rawSql"], _ = json.Marshal(sql)
+	mutated, err := json.Marshal(fields)
+	if err != nil {
+		return query, false, err
+	}
+	return mutated, true, nil
+}
+
+// normalizeTimeZone returns the time zone as named by QuestDB, or an empty string when it isn't a time zone name
+func normalizeTimeZone(timeZone string) string {
+	timeZone = strings.TrimSpace(timeZone)
+	switch {
+	case strings.EqualFold(timeZone, "utc"):
+		return "UTC"
+	case strings.EqualFold(timeZone, "browser") || !timeZoneName.MatchString(timeZone):
+		return ""
+	}
+	return timeZone
+}
@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTimeZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawSQL   string
+		timeZone string
+		want     string
+	}{
+		{name: "should replace $__timezone", rawSQL: `SELECT to_timezone(ts, $__timezone) FROM trades`, timeZone: "Europe/Paris",
+			want: `SELECT to_timezone(ts, 'Europe/Paris') FROM trades`},
+		{name: "should replace $__sampleByAlign", rawSQL: `SELECT ts, avg(price) FROM trades SAMPLE BY 1d $__sampleByAlign`, timeZone: "America/New_York",
+			want: `SELECT ts, avg(price) FROM trades SAMPLE BY 1d ALIGN TO CALENDAR TIME ZONE 'America/New_York'`},
+		{name: "should complete the alignment without time zone", rawSQL: `SELECT ts, avg(price) FROM trades SAMPLE BY 1d FILL(NULL) align to calendar time zone`,
+			timeZone: "Asia/Tokyo", want: `SELECT ts, avg(price) FROM trades SAMPLE BY 1d FILL(NULL) align to calendar time zone 'Asia/Tokyo'`},
+		{name: "should keep the alignment with a time zone", rawSQL: `SELECT ts, avg(price) FROM trades SAMPLE BY 1d ALIGN TO CALENDAR TIME ZONE 'EST'`,
+			timeZone: "Asia/Tokyo", want: `SELECT ts, avg(price) FROM trades SAMPLE BY 1d ALIGN TO CALENDAR TIME ZONE 'EST'`},
+		{name: "should name UTC as QuestDB does", rawSQL: `SELECT $__timezone`, timeZone: "utc", want: `SELECT 'UTC'`},
+		{name: "should leave the macros without time zone", rawSQL: `SELECT $__timezone`, want: `SELECT $__timezone`},
+		{name: "should leave the macros with an invalid time zone", rawSQL: `SELECT $__timezone`, timeZone: "UTC'; DROP TABLE trades", want: `SELECT $__timezone`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := fmt.Sprintf(`{"rawSql":%q,"meta":{"timezone":%q}}`, tt.rawSQL, tt.timeZone)
+			_, q := (&QuestDB{}).MutateQuery(context.Background(), backend.DataQuery{JSON: json.RawMessage(query)})
+			var mutated struct {
+				RawSQL string `json:"rawSql"`
+			}
+			require.NoError(t, json.Unmarshal(q.JSON, &mutated))
+			assert.Equal(t, tt.want, mutated.RawSQL)
+		})
+	}
+}
+
+func TestQueryKeyTimeZone(t *testing.T) {
+	query := func(timeZone string) backend.DataQuery {
+		return backend.DataQuery{JSON: json.RawMessage(fmt.Sprintf(`{"rawSql":"SELECT $__timezone","meta":{"timezone":%q}}`, timeZone))}
+	}
+	paris, err := queryKey(query("Europe/Paris"))
+	require.NoError(t, err)
+	tokyo, err := queryKey(query("Asia/Tokyo"))
+	require.NoError(t, err)
+	assert.NotEqual(t, paris, tokyo)
+}
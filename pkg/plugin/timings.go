@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryTimings - where the time of a query was spent. QuestDB only reports its own timings over the HTTP transport,
+// the time until the first response and the time spent reading the rows are measured by the connection.
+type queryTimings struct {
+	server   *serverTimings
+	response time.Duration
+	fetch    time.Duration
+	rows     int64
+}
+
+// serverTimings - timings reported by QuestDB in nanoseconds, with the number of rows it returned
+type serverTimings struct {
+	Compiler int64 `json:"compiler"`
+	Execute  int64 `json:"execute"`
+	Count    int64 `json:"count"`
+	rows     int64
+}
+
+// updateTimings records the timings of the query, a nil trace is ignored
+func (t *queryTrace) updateTimings(update func(timings *queryTimings)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	update(&t.timings)
+}
+
+func (t *queryTrace) queryTimings() queryTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timings
+}
+
+// stats returns the timings as the statistics shown by the query inspector, in milliseconds
+func (t queryTimings) stats() []data.QueryStat {
+	var stats []data.QueryStat
+	add := func(name, unit string, value float64) {
+		stats = append(stats, data.QueryStat{FieldConfig: data.FieldConfig{DisplayName: name, Unit: unit}, Value: value})
+	}
+	rows := t.rows
+	if t.server != nil {
+		add("QuestDB compile time", "ms", nanosToMillis(t.server.Compiler))
+		add("QuestDB execute time", "ms", nanosToMillis(t.server.Execute))
+		add("QuestDB count time", "ms", nanosToMillis(t.server.Count))
+		rows = t.server.rows
+	}
+	if t.response > 0 {
+		add("Time to first response", "ms", nanosToMillis(t.response.Nanoseconds()))
+		add("Time reading rows", "ms", nanosToMillis(t.fetch.Nanoseconds()))
+		add("Rows", "", float64(rows))
+	}
+	return stats
+}
+
+func nanosToMillis(nanos int64) float64 {
+	return float64(nanos) / float64(time.Millisecond)
+}
+
+// clearStats drops the timings of the frames, the ones of a cached result were measured by the query that stored it
+func clearStats(frames data.Frames) {
+	for _, frame := range frames {
+		if frame.Meta != nil {
+			frame.Meta.Stats = nil
+		}
+	}
+}
+
+// addStats adds the timings of the query to the metadata of the frames
+func addStats(frames data.Frames, timings queryTimings) {
+	stats := timings.stats()
+	if len(stats) == 0 {
+		return
+	}
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Stats = append(frame.Meta.Stats, stats...)
+	}
+}
@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryTimingsStats(t *testing.T) {
+	names := func(stats []data.QueryStat) map[string]float64 {
+		values := map[string]float64{}
+		for _, stat := range stats {
+			values[stat.DisplayName] = stat.Value
+		}
+		return values
+	}
+
+	t.Run("should report the timings measured by the connection", func(t *testing.T) {
+		timings := queryTimings{response: 20 * time.Millisecond, fetch: 1500 * time.Microsecond, rows: 42}
+		assert.Equal(t, map[string]float64{
+			"Time to first response": 20,
+			"Time reading rows":      1.5,
+			"Rows":                   42,
+		}, names(timings.stats()))
+	})
+
+	t.Run("should report the timings of QuestDB and its row count", func(t *testing.T) {
+		timings := queryTimings{
+			server:   &serverTimings{Compiler: 2500000, Execute: 1200000, rows: 7},
+			response: 5 * time.Millisecond,
+			rows:     3,
+		}
+		stats := timings.stats()
+		assert.Equal(t, map[string]float64{
+			"QuestDB compile time":   2.5,
+			"QuestDB execute time":   1.2,
+			"QuestDB count time":     0,
+			"Time to first response": 5,
+			"Time reading rows":      0,
+			"Rows":                   7,
+		}, names(stats))
+		assert.Equal(t, "ms", stats[0].Unit)
+	})
+
+	t.Run("should add the statistics to every frame", func(t *testing.T) {
+		frames := data.Frames{data.NewFrame("a"), data.NewFrame("b").SetMeta(&data.FrameMeta{ExecutedQueryString: "SELECT 1"})}
+		addStats(frames, queryTimings{response: time.Millisecond})
+		for _, frame := range frames {
+			require.NotNil(t, frame.Meta)
+			assert.Len(t, frame.Meta.Stats, 3)
+		}
+		assert.Equal(t, "SELECT 1", frames[1].Meta.ExecutedQueryString)
+
+		frame := data.NewFrame("c")
+		addStats(data.Frames{frame}, queryTimings{})
+		assert.Nil(t, frame.Meta)
+	})
+}
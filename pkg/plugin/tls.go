@@ -0,0 +1,333 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	tlsMethodFilePath    = "file-path"
+	tlsMethodFileContent = "file-content"
+
+	// sslRequestCode is sent by the client to ask the server to switch to TLS/SSL before the startup message
+	sslRequestCode = 80877103
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig creates the TLS/SSL configuration used to connect to the given host, nil when TLS/SSL is disabled.
+// The mode follows the libpq semantics: "require" only encrypts (and verifies the chain when a root certificate
+// is set), "verify-ca" verifies the chain and "verify-full" verifies the chain and the server name.
+func newTLSConfig(settings Settings, host Host) (*tls.Config, error) {
+	if settings.TlsMode == "disable" {
+		return nil, nil
+	}
+
+	caCert, clientCert, clientKey, err := settings.tlsMaterial()
+	if err != nil {
+		return nil, err
+	}
+
+	// custom root certificates are trusted on top of the system ones
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		log.DefaultLogger.Debug("System root certificates are not available", "error", err)
+		roots = x509.NewCertPool()
+	}
+	if caCert != "" && !roots.AppendCertsFromPEM([]byte(caCert)) {
+		return nil, ErrorMessageInvalidTlsCACert
+	}
+
+	config := &tls.Config{
+		RootCAs:    roots,
+		ServerName: host.Server,
+		MinVersion: tls.VersionTLS12,
+	}
+	if settings.TlsServerName != "" {
+		config.ServerName = settings.TlsServerName
+	}
+	if settings.TlsMinVersion != "" {
+		version, ok := tlsVersions[settings.TlsMinVersion]
+		if !ok {
+			return nil, ErrorMessageInvalidTlsMinVersion
+		}
+		config.MinVersion = version
+	}
+
+	if clientCert != "" && clientKey != "" {
+		log.DefaultLogger.Debug("Setting TLS/SSL client auth")
+		certificate, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS/SSL client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	} else if clientCert != "" || clientKey != "" {
+		return nil, fmt.Errorf("TLS/SSL client certificate and key must both be specified")
+	}
+
+	switch {
+	case settings.TlsMode == "verify-full":
+	case settings.TlsMode == "verify-ca" || caCert != "":
+		// the chain is verified by hand, as the server name may not match
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyChain(state, roots)
+		}
+	default:
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+func verifyChain(state tls.ConnectionState, roots *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server did not present a TLS/SSL certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// tlsDialer negotiates TLS/SSL the way PostgreSQL clients do, by sending an SSLRequest
+// before the handshake, so that the driver itself talks plain text over the encrypted connection
+type tlsDialer struct {
+	dialer proxy.ContextDialer
+	config *tls.Config
+}
+
+// Dial implements pq.Dialer
+func (d *tlsDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialTimeout implements pq.Dialer
+func (d *tlsDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+// DialContext implements pq.DialerContext
+func (d *tlsDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	tlsConn, err := negotiateTLS(ctx, conn, d.config)
+	if err != nil {
+		log.DefaultLogger.Debug("QuestDB TLS/SSL handshake failed", "address", address, "tls", time.Since(start), "error", err)
+		_ = conn.Close()
+		return nil, err
+	}
+	log.DefaultLogger.Debug("QuestDB TLS/SSL handshake completed", "address", address, "tls", time.Since(start),
+		"version", tls.VersionName(tlsConn.ConnectionState().Version))
+	if trace := dialTraceFromContext(ctx); trace != nil {
+		trace.setTLS(tlsConn.ConnectionState())
+	}
+	return tlsConn, nil
+}
+
+func negotiateTLS(ctx context.Context, conn net.Conn, config *tls.Config) (*tls.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+		defer conn.SetDeadline(time.Time{}) //nolint:errcheck
+	}
+
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], sslRequestCode)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	response := make([]byte, 1)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	if response[0] != 'S' {
+		return nil, ErrorMessageTlsNotSupported
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("TLS/SSL handshake failed: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// tlsFiles returns the certificate and key files configured with the "file-path" method
+func (settings *Settings) tlsFiles() []string {
+	if settings.TlsMode == "disable" || settings.ConfigurationMethod != tlsMethodFilePath {
+		return nil
+	}
+	var files []string
+	for _, file := range []string{settings.TlsCACertFile, settings.TlsClientCertFile, settings.TlsClientKeyFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// tlsMaterial returns the PEM encoded root certificate, client certificate and client key,
+// read either from the secure settings or from the configured files
+func (settings *Settings) tlsMaterial() (caCert, clientCert, clientKey string, err error) {
+	if settings.ConfigurationMethod != tlsMethodFilePath {
+		return settings.TlsCACert, settings.TlsClientCert, settings.TlsClientKey, nil
+	}
+	read := func(file string) (string, error) {
+		if file == "" {
+			return "", nil
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("could not read TLS/SSL file %s: %w", file, err)
+		}
+		return string(content), nil
+	}
+	if caCert, err = read(settings.TlsCACertFile); err != nil {
+		return
+	}
+	if clientCert, err = read(settings.TlsClientCertFile); err != nil {
+		return
+	}
+	clientKey, err = read(settings.TlsClientKeyFile)
+	return
+}
+
+// validateTlsFiles checks that the configured files exist and contain valid certificates and keys
+func (settings *Settings) validateTlsFiles() (errs SettingsErrors) {
+	if len(settings.tlsFiles()) == 0 {
+		return nil
+	}
+	read := func(field, file string) string {
+		if file == "" {
+			return ""
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			errs.add(field, fmt.Errorf("%s: %w", err.Error(), ErrorMessageInvalidTlsFile))
+			return ""
+		}
+		return string(content)
+	}
+	caCert := read("tlsCACertFile", settings.TlsCACertFile)
+	clientCert := read("tlsClientCertFile", settings.TlsClientCertFile)
+	clientKey := read("tlsClientKeyFile", settings.TlsClientKeyFile)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if caCert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(caCert)) {
+		errs.add("tlsCACertFile", fmt.Errorf("%s: %w", settings.TlsCACertFile, ErrorMessageInvalidTlsCACertFile))
+	}
+	if (settings.TlsClientCertFile == "") != (settings.TlsClientKeyFile == "") {
+		errs.add("tlsClientCertFile", ErrorMessageInvalidTlsClientCertFile)
+	} else if clientCert != "" {
+		if _, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey)); err != nil {
+			errs.add("tlsClientCertFile", fmt.Errorf("%s: %w", err.Error(), ErrorMessageInvalidTlsClientCertFile))
+		}
+	}
+	return errs
+}
+
+// fileVersion identifies the content of a file without reading it
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// reloadingConnector rebuilds the underlying connector whenever one of the certificate files
+// changes on disk, so that rotated certificates are used for new connections without a restart
+type reloadingConnector struct {
+	files []string
+	build func() (driver.Connector, error)
+
+	mu        sync.Mutex
+	connector driver.Connector
+	versions  map[string]fileVersion
+}
+
+func newReloadingConnector(files []string, build func() (driver.Connector, error)) (*reloadingConnector, error) {
+	c := &reloadingConnector{files: files, build: build}
+	c.versions = c.stat()
+	connector, err := build()
+	if err != nil {
+		return nil, err
+	}
+	c.connector = connector
+	return c, nil
+}
+
+func (c *reloadingConnector) stat() map[string]fileVersion {
+	versions := map[string]fileVersion{}
+	for _, file := range c.files {
+		if info, err := os.Stat(file); err == nil {
+			versions[file] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return versions
+}
+
+func (c *reloadingConnector) current() driver.Connector {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	versions := c.stat()
+	changed := len(versions) != len(c.versions)
+	for file, version := range versions {
+		if c.versions[file] != version {
+			changed = true
+		}
+	}
+	if !changed {
+		return c.connector
+	}
+
+	connector, err := c.build()
+	if err != nil {
+		// files may be caught in the middle of a rotation, keep the previous certificates until the next attempt
+		log.DefaultLogger.Warn("QuestDB TLS/SSL certificates reload failed", "error", err)
+		return c.connector
+	}
+	log.DefaultLogger.Info("QuestDB TLS/SSL certificates reloaded", "files", c.files)
+	c.connector = connector
+	c.versions = versions
+	return connector
+}
+
+// Connect implements driver.Connector
+func (c *reloadingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.current().Connect(ctx)
+}
+
+// Driver implements driver.Connector
+func (c *reloadingConnector) Driver() driver.Driver {
+	return c.current().Driver()
+}
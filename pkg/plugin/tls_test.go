@@ -0,0 +1,335 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const keysPath = "../../keys"
+
+func copyFile(t *testing.T, src, dst string) {
+	content, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dst, content, 0600))
+}
+
+func filePathSettings(caCert, clientCert, clientKey string) Settings {
+	return Settings{
+		Server:              "localhost",
+		Port:                8812,
+		Username:            "admin",
+		Password:            "quest",
+		TlsMode:             "verify-full",
+		ConfigurationMethod: tlsMethodFilePath,
+		TlsCACertFile:       caCert,
+		TlsClientCertFile:   clientCert,
+		TlsClientKeyFile:    clientKey,
+	}
+}
+
+func TestValidateTlsFiles(t *testing.T) {
+	caCert := path.Join(keysPath, "my-own-ca.crt")
+	clientCert := path.Join(keysPath, "server.crt")
+	clientKey := path.Join(keysPath, "server.key")
+
+	tests := []struct {
+		name     string
+		settings Settings
+		wantErr  error
+	}{
+		{name: "should accept valid files", settings: filePathSettings(caCert, clientCert, clientKey)},
+		{name: "should accept root certificate only", settings: filePathSettings(caCert, "", "")},
+		{name: "should capture missing file", settings: filePathSettings(path.Join(keysPath, "missing.crt"), "", ""), wantErr: ErrorMessageInvalidTlsFile},
+		{name: "should capture invalid root certificate", settings: filePathSettings(clientKey, "", ""), wantErr: ErrorMessageInvalidTlsCACertFile},
+		{name: "should capture client certificate without key", settings: filePathSettings(caCert, clientCert, ""), wantErr: ErrorMessageInvalidTlsClientCertFile},
+		{name: "should capture mismatched key pair", settings: filePathSettings(caCert, clientCert, path.Join(keysPath, "my-own-ca.key")), wantErr: ErrorMessageInvalidTlsClientCertFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.isValid()
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("should ignore files when tls is disabled", func(t *testing.T) {
+		settings := filePathSettings(path.Join(keysPath, "missing.crt"), "", "")
+		settings.TlsMode = "disable"
+		assert.NoError(t, settings.isValid())
+	})
+}
+
+func TestGenerateConnectionStringWithTls(t *testing.T) {
+	settings := filePathSettings(path.Join(keysPath, "my-own-ca.crt"), "", "")
+	connStr, err := GenerateConnectionString(settings, "")
+	require.NoError(t, err)
+	assert.Contains(t, connStr, " sslmode='disable'")
+	assert.NotContains(t, connStr, "sslinline")
+	assert.NotContains(t, connStr, "BEGIN")
+
+	settings.ConfigurationMethod = "foo"
+	_, err = GenerateConnectionString(settings, "")
+	assert.Error(t, err)
+}
+
+// testPKI is a root certificate and a server certificate signed by it
+type testPKI struct {
+	caPEM  string
+	server tls.Certificate
+}
+
+func newTestPKI(t *testing.T, serverName string) testPKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: serverName},
+		DNSNames:     []string{serverName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caTemplate, &serverKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	return testPKI{
+		caPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+		server: tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey},
+	}
+}
+
+// startSSLServer accepts PostgreSQL SSLRequests, answers them with the given response
+// and completes the TLS handshake when the response is 'S'
+func startSSLServer(t *testing.T, response byte, certificate tls.Certificate) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				request := make([]byte, 8)
+				if _, err := io.ReadFull(conn, request); err != nil || binary.BigEndian.Uint32(request[4:]) != sslRequestCode {
+					return
+				}
+				if _, err := conn.Write([]byte{response}); err != nil || response != 'S' {
+					return
+				}
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{certificate}})
+				if tlsConn.Handshake() == nil {
+					_, _ = tlsConn.Write([]byte("ok"))
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func dialTLS(settings Settings, address string) error {
+	host, port, _ := net.SplitHostPort(address)
+	p, _ := strconv.ParseInt(port, 10, 64)
+	config, err := newTLSConfig(settings, Host{Server: host, Port: p})
+	if err != nil {
+		return err
+	}
+	dialer := &tlsDialer{dialer: &net.Dialer{}, config: config}
+	conn, err := dialer.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	response := make([]byte, 2)
+	_, err = io.ReadFull(conn, response)
+	return err
+}
+
+func TestTlsDialer(t *testing.T) {
+	pki := newTestPKI(t, "questdb.internal")
+	address := startSSLServer(t, 'S', pki.server)
+	other := newTestPKI(t, "questdb.internal")
+
+	settings := Settings{TlsMode: "verify-full", ConfigurationMethod: tlsMethodFileContent, TlsCACert: pki.caPEM}
+
+	t.Run("should verify full with server name override", func(t *testing.T) {
+		s := settings
+		s.TlsServerName = "questdb.internal"
+		assert.NoError(t, dialTLS(s, address))
+	})
+
+	t.Run("should fail verify full when server name does not match", func(t *testing.T) {
+		assert.Error(t, dialTLS(settings, address))
+	})
+
+	t.Run("should verify ca without checking the server name", func(t *testing.T) {
+		s := settings
+		s.TlsMode = "verify-ca"
+		assert.NoError(t, dialTLS(s, address))
+	})
+
+	t.Run("should fail verify ca with another root certificate", func(t *testing.T) {
+		s := settings
+		s.TlsMode = "verify-ca"
+		s.TlsCACert = other.caPEM
+		assert.Error(t, dialTLS(s, address))
+	})
+
+	t.Run("should only encrypt in require mode", func(t *testing.T) {
+		s := settings
+		s.TlsMode = "require"
+		s.TlsCACert = ""
+		assert.NoError(t, dialTLS(s, address))
+	})
+
+	t.Run("should fail when the server does not support TLS", func(t *testing.T) {
+		address := startSSLServer(t, 'N', pki.server)
+		s := settings
+		s.TlsMode = "require"
+		assert.ErrorIs(t, dialTLS(s, address), ErrorMessageTlsNotSupported)
+	})
+
+	t.Run("should honour minimum version", func(t *testing.T) {
+		s := settings
+		s.TlsMode = "verify-ca"
+		s.TlsMinVersion = "1.3"
+		config, err := newTLSConfig(s, Host{Server: "localhost"})
+		require.NoError(t, err)
+		assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+		assert.NoError(t, dialTLS(s, address))
+
+		s.TlsMinVersion = "2.0"
+		_, err = newTLSConfig(s, Host{Server: "localhost"})
+		assert.ErrorIs(t, err, ErrorMessageInvalidTlsMinVersion)
+	})
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Run("should be nil when tls is disabled", func(t *testing.T) {
+		config, err := newTLSConfig(Settings{TlsMode: "disable"}, Host{Server: "localhost"})
+		assert.NoError(t, err)
+		assert.Nil(t, config)
+	})
+
+	t.Run("should load client certificate from files", func(t *testing.T) {
+		settings := filePathSettings(path.Join(keysPath, "my-own-ca.crt"), path.Join(keysPath, "server.crt"), path.Join(keysPath, "server.key"))
+		config, err := newTLSConfig(settings, Host{Server: "localhost"})
+		require.NoError(t, err)
+		assert.Len(t, config.Certificates, 1)
+		assert.Equal(t, "localhost", config.ServerName)
+		assert.False(t, config.InsecureSkipVerify)
+	})
+
+	t.Run("should require both client certificate and key", func(t *testing.T) {
+		_, err := newTLSConfig(Settings{TlsMode: "require", TlsClientCert: "cert"}, Host{Server: "localhost"})
+		assert.Error(t, err)
+	})
+
+	t.Run("should reject invalid root certificate", func(t *testing.T) {
+		_, err := newTLSConfig(Settings{TlsMode: "require", TlsCACert: "caCert"}, Host{Server: "localhost"})
+		assert.ErrorIs(t, err, ErrorMessageInvalidTlsCACert)
+	})
+}
+
+func TestReloadingConnector(t *testing.T) {
+	dir := t.TempDir()
+	caCert := path.Join(dir, "ca.crt")
+	copyFile(t, path.Join(keysPath, "my-own-ca.crt"), caCert)
+
+	builds := 0
+	fail := false
+	connector, err := newReloadingConnector([]string{caCert}, func() (driver.Connector, error) {
+		if fail {
+			return nil, errors.New("invalid certificate")
+		}
+		builds++
+		return &fakeConnector{host: "localhost"}, nil
+	})
+	require.NoError(t, err)
+
+	_, err = connector.Connect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, builds)
+
+	// certificate rotated
+	copyFile(t, path.Join(keysPath, "server.crt"), caCert)
+	require.NoError(t, os.Chtimes(caCert, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	_, err = connector.Connect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, builds)
+
+	// unchanged files do not trigger a reload
+	_, err = connector.Connect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, builds)
+
+	// a failed reload keeps the previous connector and is retried
+	fail = true
+	require.NoError(t, os.Chtimes(caCert, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute)))
+	_, err = connector.Connect(context.Background())
+	require.NoError(t, err)
+	fail = false
+	_, err = connector.Connect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, builds)
+}
+
+func TestTlsDialerTrace(t *testing.T) {
+	pki := newTestPKI(t, "questdb.internal")
+	address := startSSLServer(t, 'S', pki.server)
+	config, err := newTLSConfig(Settings{TlsMode: "verify-ca", TlsCACert: pki.caPEM, TlsMinVersion: "1.3"}, Host{Server: "questdb.internal"})
+	require.NoError(t, err)
+
+	trace := &dialTrace{}
+	dialer := &tlsDialer{dialer: &net.Dialer{}, config: config}
+	conn, err := dialer.DialContext(withDialTrace(context.Background(), trace), "tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	details := newTLSDetails(trace.tlsState())
+	require.NotNil(t, details)
+	assert.Equal(t, "TLS 1.3", details.Version)
+	assert.Equal(t, "questdb.internal", details.ServerName)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), details.PeerCertificateExpiry, time.Minute)
+	assert.Nil(t, newTLSDetails(nil))
+}
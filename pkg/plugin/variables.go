@@ -0,0 +1,187 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+var (
+	// varPattern matches $__var(name) and $__var(name, type)
+	varPattern = regexp.MustCompile(`\$__var\(\s*(\w+)\s*(?:,\s*(\w+)\s*)?\)`)
+	// varColumnPattern matches the column compared to the variable, at the end of the SQL preceding it
+	varColumnPattern = regexp.MustCompile(`(?i)"?(\w+)"?\s*(?:=|!=|<>|<=|>=|<|>|!?~|(?:not\s+)?i?like|(?:not\s+)?in\s*\()\s*$`)
+)
+
+type queryArgsKey struct{}
+
+func withQueryArgs(ctx context.Context, args []interface{}) context.Context {
+	return context.WithValue(ctx, queryArgsKey{}, args)
+}
+
+func queryArgsFromContext(ctx context.Context) []interface{} {
+	args, _ := ctx.Value(queryArgsKey{}).([]interface{})
+	return args
+}
+
+// SetQueryArgs implements sqlds.QueryArgSetter, the arguments are the values of the $__var placeholders
+func (h *QuestDB) SetQueryArgs(ctx context.Context, _ http.Header) []interface{} {
+	return queryArgsFromContext(ctx)
+}
+
+// setTemplateVariables replaces the $__var(name) placeholders of the rawSql by the values of the template variables
+// sent by the editor with the query, a list of values for variables with several values, so that the variable is
+// used as `column IN ($__var(name))`. With bind the values are bound as query arguments, as $1, $2 and so on, they
+// are otherwise written as literals, as the HTTP transport doesn't bind arguments. Either way the values are typed
+// after the type given as second argument, or the type of the column they are compared to.
+// Placeholders of unknown variables, or with values not suiting their type, are left for the $__var macro to fail.
+func setTemplateVariables(ctx context.Context, query json.RawMessage, schema *schemaResources, bind bool) (json.RawMessage, []interface{}, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(query, &fields); err != nil {
+		return query, nil, err
+	}
+	var rawSQL string
+	if err := json.Unmarshal(fields["rawSql"], &rawSQL); err != nil || !varPattern.MatchString(rawSQL) {
+		return query, nil, nil
+	}
+	var variables map[string][]string
+	if message, ok := fields["templateVariables"]; ok {
+		if err := json.Unmarshal(message, &variables); err != nil {
+			return query, nil, err
+		}
+	}
+
+	var columns []SchemaColumn
+	if match := fromTable.FindStringSubmatch(rawSQL); match != nil && schema != nil {
+		var err error
+		if columns, err = schema.tableColumns(ctx, match[1]); err != nil {
+			log.DefaultLogger.Debug("QuestDB template variables are typed as strings, the columns of the table are unknown", "table", match[1], "error", err)
+		}
+	}
+
+	var args []interface{}
+	var sql strings.Builder
+	last := 0
+	for _, match := range varPattern.FindAllStringSubmatchIndex(rawSQL, -1) {
+		name := rawSQL[match[2]:match[3]]
+		sql.WriteString(rawSQL[last:match[0]])
+		last = match[1]
+
+		values, ok := variables[name]
+		if !ok {
+			sql.WriteString(rawSQL[match[0]:match[1]])
+			continue
+		}
+		column, columnType := name, "string"
+		if match[4] >= 0 {
+			columnType = strings.ToLower(rawSQL[match[4]:match[5]])
+		} else if m := varColumnPattern.FindStringSubmatch(rawSQL[:match[0]]); m != nil {
+			if t, ok := columnTypeOf(columns, m[1]); ok {
+				column, columnType = m[1], t
+			}
+		}
+
+		placeholders, err := varPlaceholders(values, column, columnType, bind, len(args))
+		if err != nil {
+			log.DefaultLogger.Warn("QuestDB template variable not applied", "variable", name, "error", err)
+			queryTraceFromContext(ctx).addNotice(fmt.Sprintf("Template variable %s not applied: %s", name, err))
+			sql.WriteString(rawSQL[match[0]:match[1]])
+			continue
+		}
+		for _, placeholder := range placeholders {
+			if placeholder.arg != nil {
+				args = append(args, placeholder.arg)
+			}
+		}
+		sql.WriteString(joinPlaceholders(placeholders))
+	}
+	sql.WriteString(rawSQL[last:])
+
+	fields["rawSql"], _ = json.Marshal(sql.String())
+	mutated, err := json.Marshal(fields)
+	if err != nil {
+		return query, nil, err
+	}
+	return mutated, args, nil
+}
+
+// varPlaceholder - text replacing a value of a variable, with the argument it is bound to
+type varPlaceholder struct {
+	text string
+	arg  interface{}
+}
+
+// varPlaceholders returns the placeholders of the values, numbered after the arguments already bound.
+// A variable without values is replaced by NULL, which no value is equal to.
+func varPlaceholders(values []string, column, columnType string, bind bool, bound int) ([]varPlaceholder, error) {
+	if len(values) == 0 {
+		return []varPlaceholder{{text: "NULL"}}, nil
+	}
+	placeholders := make([]varPlaceholder, 0, len(values))
+	for _, value := range values {
+		if !bind {
+			literal, err := adHocLiteral(value, column, columnType)
+			if err != nil {
+				return nil, err
+			}
+			placeholders = append(placeholders, varPlaceholder{text: literal})
+			continue
+		}
+		arg, err := varArg(value, column, columnType)
+		if err != nil {
+			return nil, err
+		}
+		bound++
+		placeholders = append(placeholders, varPlaceholder{text: "$" + strconv.Itoa(bound), arg: arg})
+	}
+	return placeholders, nil
+}
+
+func joinPlaceholders(placeholders []varPlaceholder) string {
+	texts := make([]string, 0, len(placeholders))
+	for _, placeholder := range placeholders {
+		texts = append(texts, placeholder.text)
+	}
+	return strings.Join(texts, ", ")
+}
+
+// varArg returns the value as an argument of the type of the column
+func varArg(value, column, columnType string) (interface{}, error) {
+	trimmed := strings.TrimSpace(value)
+	switch {
+	case isNumberColumn(columnType):
+		if i, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil || !numberLiteral.MatchString(trimmed) {
+			return nil, fmt.Errorf("%q is not a number, as %s is", value, column)
+		}
+		return f, nil
+	case columnType == "boolean":
+		b, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean, as %s is", value, column)
+		}
+		return b, nil
+	case columnType == "timestamp" || columnType == "timestamp_ns" || columnType == "date":
+		ts, err := parseAdHocTime(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a timestamp, as %s is", value, column)
+		}
+		return ts.UTC(), nil
+	case columnType == "ipv4":
+		if _, err := adHocLiteral(value, column, columnType); err != nil {
+			return nil, err
+		}
+		return trimmed, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTemplateVariables(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch query := r.URL.Query().Get("query"); {
+		case query == "SELECT 1":
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"1","type":"INT"}],"dataset":[[1]]}`)
+		case strings.Contains(query, "FROM table_columns('trades')"):
+			_, _ = fmt.Fprint(w, `{"columns":[{"name":"column","type":"STRING"},{"name":"type","type":"STRING"},{"name":"designated","type":"BOOLEAN"}],`+
+				`"dataset":[["ts","TIMESTAMP",true],["sym","SYMBOL",false],["price","DOUBLE",false],["buy","BOOLEAN",false]]}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"table does not exist [table=missing]","position":0}`)
+		}
+	}))
+	defer server.Close()
+	settings, host := httpSettings(t, server)
+	connector, err := newHostConnector(settings, host, "", nil)
+	require.NoError(t, err)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	schema := newSchemaResources(time.Minute, func(context.Context) (*sql.DB, error) { return db, nil })
+
+	tests := []struct {
+		name      string
+		rawSQL    string
+		variables string
+		bind      bool
+		want      string
+		args      []interface{}
+		notices   []string
+	}{
+		{name: "should bind a value", rawSQL: `SELECT * FROM trades WHERE sym = $__var(sym)`, variables: `{"sym":["O'Brien"]}`, bind: true,
+			want: `SELECT * FROM trades WHERE sym = $1`, args: []interface{}{"O'Brien"}},
+		{name: "should bind several values", rawSQL: `SELECT * FROM trades WHERE price IN ($__var(prices)) AND sym = $__var(sym)`,
+			variables: `{"prices":["1","2.5"],"sym":["BTC"]}`, bind: true,
+			want: `SELECT * FROM trades WHERE price IN ($1, $2) AND sym = $3`, args: []interface{}{int64(1), 2.5, "BTC"}},
+		{name: "should type the arguments after the columns", rawSQL: `SELECT * FROM "trades" WHERE "buy" = $__var(buy) AND ts > $__var(since)`,
+			variables: `{"buy":["TRUE"],"since":["1704067200000"]}`, bind: true,
+			want: `SELECT * FROM "trades" WHERE "buy" = $1 AND ts > $2`, args: []interface{}{true, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "should type the arguments after the given type", rawSQL: `SELECT * FROM missing WHERE x = $__var(x, long)`, variables: `{"x":["42"]}`, bind: true,
+			want: `SELECT * FROM missing WHERE x = $1`, args: []interface{}{int64(42)}},
+		{name: "should write literals", rawSQL: `SELECT * FROM trades WHERE sym IN ($__var(sym)) AND price > $__var(price)`,
+			variables: `{"sym":["a","O'Brien"],"price":["10"]}`,
+			want:      `SELECT * FROM trades WHERE sym IN ('a', 'O''Brien') AND price > 10`},
+		{name: "should replace variables without values by NULL", rawSQL: `SELECT * FROM trades WHERE sym IN ($__var(sym))`, variables: `{"sym":[]}`, bind: true,
+			want: `SELECT * FROM trades WHERE sym IN (NULL)`},
+		{name: "should leave the invalid values", rawSQL: `SELECT * FROM trades WHERE price = $__var(price) AND sym = $__var(unknown)`,
+			variables: `{"price":["1; DROP TABLE trades"]}`, bind: true,
+			want:    `SELECT * FROM trades WHERE price = $__var(price) AND sym = $__var(unknown)`,
+			notices: []string{`Template variable price not applied: "1; DROP TABLE trades" is not a number, as price is`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &QuestDB{schema: schema, transport: transportHTTP}
+			if tt.bind {
+				h.transport = transportPgWire
+			}
+			trace := &queryTrace{}
+			query := fmt.Sprintf(`{"rawSql":%q,"templateVariables":%s}`, tt.rawSQL, tt.variables)
+			ctx, q := h.MutateQuery(withQueryTrace(context.Background(), trace), backend.DataQuery{JSON: json.RawMessage(query)})
+			var mutated struct {
+				RawSQL string `json:"rawSql"`
+			}
+			require.NoError(t, json.Unmarshal(q.JSON, &mutated))
+			assert.Equal(t, tt.want, mutated.RawSQL)
+			assert.Equal(t, tt.args, h.SetQueryArgs(ctx, nil))
+			assert.Equal(t, tt.notices, trace.queryNotices())
+		})
+	}
+}
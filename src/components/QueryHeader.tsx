@@ -2,6 +2,7 @@ import React from 'react';
 import { BuilderMode, QuestDBQuery, Format, QueryType, QuestDBBuilderQuery } from '../types';
 import { QueryTypeSwitcher } from 'components/QueryTypeSwitcher';
 import { FormatSelect } from '../components/FormatSelect';
+import { StreamSwitch } from '../components/StreamSwitch';
 import { Button } from '@grafana/ui';
 import { getFormat } from 'components/editor';
 import { EditorHeader, FlexItem } from '@grafana/plugin-ui';
@@ -53,6 +54,7 @@ export const QueryHeader = ({ query, onChange, onRunQuery, datasource }: QueryHe
     <EditorHeader>
       <QueryTypeSwitcher query={query} onChange={onChange} datasource={datasource} />
       <FlexItem grow={1} />
+      <StreamSwitch stream={query.stream ?? false} onChange={(stream) => onChange({ ...query, stream })} />
       <Button variant="primary" icon="play" size="sm" onClick={runQuery}>
         Run query
       </Button>
@@ -0,0 +1,17 @@
+import React from 'react';
+import { fireEvent, render } from '@testing-library/react';
+import { StreamSwitch } from './StreamSwitch';
+
+describe('StreamSwitch', () => {
+  it('renders the stream switch', () => {
+    const result = render(<StreamSwitch stream={false} onChange={() => {}} />);
+    expect(result.container.firstChild).not.toBeNull();
+  });
+
+  it('toggles the stream', () => {
+    const onChange = jest.fn();
+    const result = render(<StreamSwitch stream={false} onChange={onChange} />);
+    fireEvent.click(result.getByRole('switch'));
+    expect(onChange).toHaveBeenCalledWith(true);
+  });
+});
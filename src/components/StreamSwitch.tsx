@@ -0,0 +1,19 @@
+import React from 'react';
+import { selectors } from './../selectors';
+import { InlineSwitch } from '@grafana/ui';
+
+export type Props = { stream: boolean; onChange: (stream: boolean) => void };
+
+export const StreamSwitch = (props: Props) => {
+  const { onChange, stream } = props;
+  const { label, tooltip } = selectors.components.QueryEditor.Stream;
+  return (
+    <InlineSwitch
+      label={label}
+      showLabel={true}
+      title={tooltip}
+      value={stream}
+      onChange={(e) => onChange(e.currentTarget.checked)}
+    />
+  );
+};
@@ -1,3 +1,4 @@
+import * as fs from 'fs';
 import {
   BuilderMetricFieldAggregation,
   BuilderMode,
@@ -114,6 +115,20 @@ describe('isNumberType', () => {
   });
 });
 
+// cases shared with the Go implementation of the builder, see pkg/builder
+const goldenCases: Array<{ name: string; builderOptions: any; templateVars?: any[]; sql: string }> = JSON.parse(
+  fs.readFileSync('./pkg/builder/testdata/sql.golden.json', 'utf-8')
+);
+
+describe('Utils: getSQLFromQueryOptions golden cases', () => {
+  it.each(goldenCases.map((c) => [c.name, c.builderOptions, c.templateVars ?? [], c.sql]))(
+    '%s',
+    (_, builderOptions, templateVars, sql) => {
+      expect(getSQLFromQueryOptions(builderOptions, templateVars)).toBe(sql);
+    }
+  );
+});
+
 describe('Utils: getSQLFromQueryOptions and getQueryOptionsFromSql', () => {
   it(
     'handles a table without a database',
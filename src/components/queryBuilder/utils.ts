@@ -926,7 +926,9 @@ function formatStringValue(
   const filter = Array.isArray(currentFilter) ? currentFilter[0] : currentFilter;
   const extractedVariableName = filter.substring(1).replace(/[{}]/g, '');
   const varConfigForFilter = templateVars.find((tv) => tv.name === extractedVariableName);
-  return filter.startsWith('$') && (multipleValue || varConfigForFilter?.current.value.length === 1)
+  const value = varConfigForFilter?.current.value;
+  const singleValue = typeof value === 'string' || (Array.isArray(value) && value.length === 1);
+  return filter.startsWith('$') && (multipleValue || singleValue)
     ? ` ${filter || ''}`
     : ` '${filter || ''}'`;
 }
@@ -13,12 +13,27 @@ const macros = [
     {
         label: '$__timeFilter(timestampColumn)',
         documentation: 'Will be replaced by a conditional that filters the data (using the provided column) based on the time range of the panel. ' +
-            'Example: timestampColumn >= cast(1706263425598000 as timestamp) AND timestampColumn <= cast(1706285057560000 as timestamp)',
+            'Example: timestampColumn >= cast(1706263425598000 as timestamp) AND timestampColumn <= cast(1706285057560000 as timestamp). ' +
+            'TIMESTAMP_NS columns are filtered with nanosecond timestamps, the type can also be given as second argument: timestamp or timestamp_ns',
     },
     {
         label: '$__sampleByInterval',
         documentation: 'Will be replaced by the interval, followed by unit: d, h, s or T (millisecond). Example: 1d, 5h, 20s, 1T',
     },
+    {
+        label: '$__sampleByAlign',
+        documentation: 'Will be replaced by the clause aligning the SAMPLE BY buckets to the calendar of the time zone of the dashboard. ' +
+            "Example: ALIGN TO CALENDAR TIME ZONE 'Europe/Paris'",
+    },
+    {
+        label: '$__timezone',
+        documentation: "Will be replaced by the time zone of the dashboard, UTC by default. Example: 'Europe/Paris'",
+    },
+    {
+        label: '$__var(variable)',
+        documentation: 'Will be replaced by the values of the template variable, bound as query parameters and typed after the compared column. ' +
+            'An optional second argument sets the type. Example: symbol IN ($__var(symbols))',
+    },
 ];
 
 export function getMacroAndVarCompletion(range: Range) {
@@ -86,6 +86,30 @@ describe('QuestDBDatasource', () => {
       expect(spyOnGetVars).toHaveBeenCalled();
       expect(val).toEqual({ rawSql: `1=1`, queryType: QueryType.SQL });
     });
+    it('sends the values of the $__var variables', async () => {
+      const rawSql = 'select * from t where host in ($__var(host)) and region = $__var(region)';
+      const query = { rawSql, queryType: QueryType.SQL } as QuestDBQuery;
+      jest.spyOn(templateSrvMock, 'getVariables').mockImplementation(() => []);
+      jest.spyOn(templateSrvMock, 'replace').mockImplementation((target: string, _scoped: any, format?: any) => {
+        if (target === '${host}') {
+          return format(['a', 'b']);
+        }
+        if (target === '${region}') {
+          return format('eu');
+        }
+        return target;
+      });
+      const val = createInstance({}).applyTemplateVariables(query, {});
+      expect(val.templateVariables).toEqual({ host: ['a', 'b'], region: ['eu'] });
+      expect(val.rawSql).toEqual(query.rawSql);
+    });
+    it('leaves out the unknown $__var variables', async () => {
+      const query = { rawSql: 'select * from t where host = $__var(host)', queryType: QueryType.SQL } as QuestDBQuery;
+      jest.spyOn(templateSrvMock, 'getVariables').mockImplementation(() => []);
+      jest.spyOn(templateSrvMock, 'replace').mockImplementation((target: string) => target);
+      const val = createInstance({}).applyTemplateVariables(query, {});
+      expect(val.templateVariables).toBeUndefined();
+    });
   });
 
   describe('Tag Keys', () => {
@@ -202,29 +226,47 @@ describe('QuestDBDatasource', () => {
   });
 
   describe('fetchFieldsFull', () => {
-    it('sends a correct query when only table name is provided', async () => {
+    it('requests the columns of the table from the backend', async () => {
       const ds = cloneDeep(mockDatasource);
-      const frame = new ArrayDataFrame([{ column: 'column', type: 'string', designated: false }]);
-      const spyOnQuery = jest.spyOn(ds, 'query').mockImplementation((_request) => of({ data: [frame] }));
-      await ds.fetchFields('table_name');
-      const expected = { rawSql: 'select "column", type, designated from table_columns(\'table_name\')' };
-
-      expect(spyOnQuery).toHaveBeenCalledWith(
-        expect.objectContaining({ targets: expect.arrayContaining([expect.objectContaining(expected)]) })
-      );
+      const items = [{ name: 'column', type: 'STRING', designated: false }];
+      const page = { items, total: 1, offset: 0, limit: 10000 };
+      const spyOnResource = jest.spyOn(ds, 'getResource').mockImplementation(() => Promise.resolve(page));
+      const fields = await ds.fetchFields('table_name');
+
+      expect(spyOnResource).toHaveBeenCalledWith('tables/table_name/columns', { offset: 0, limit: 10000 });
+      expect(fields).toEqual([
+        { name: 'column', type: 'STRING', label: 'column [STRING]', picklistValues: [], designated: false },
+      ]);
     });
 
-    it('sends a correct query when table name contains a dot', async () => {
+    it('escapes the table name when it contains special characters', async () => {
       const ds = cloneDeep(mockDatasource);
-      const frame = new ArrayDataFrame([{ column: 'column', type: 'string', designated: false }]);
-      const spyOnQuery = jest.spyOn(ds, 'query').mockImplementation((_) => of({ data: [frame] }));
+      const page = { items: [], total: 0, offset: 0, limit: 10000 };
+      const spyOnResource = jest.spyOn(ds, 'getResource').mockImplementation(() => Promise.resolve(page));
 
-      await ds.fetchFields('table.name');
-      const expected = { rawSql: 'select "column", type, designated from table_columns(\'table.name\')' };
+      await ds.fetchFields('table/name');
+      expect(spyOnResource).toHaveBeenCalledWith('tables/table%2Fname/columns', { offset: 0, limit: 10000 });
+    });
+  });
 
-      expect(spyOnQuery).toHaveBeenCalledWith(
-        expect.objectContaining({ targets: expect.arrayContaining([expect.objectContaining(expected)]) })
-      );
+  describe('fetchTables', () => {
+    it('reads every page of the tables', async () => {
+      const ds = cloneDeep(mockDatasource);
+      const table = (tableName: string) => ({
+        tableName,
+        partitionBy: 'DAY',
+        designatedTimestamp: 'ts',
+        walEnabled: true,
+        dedup: false,
+      });
+      const spyOnResource = jest
+        .spyOn(ds, 'getResource')
+        .mockImplementationOnce(() => Promise.resolve({ items: [table('a')], total: 2, offset: 0, limit: 1 }))
+        .mockImplementationOnce(() => Promise.resolve({ items: [table('b')], total: 2, offset: 1, limit: 1 }));
+
+      const tables = await ds.fetchTables('x');
+      expect(tables.map((t) => t.tableName)).toEqual(['a', 'b']);
+      expect(spyOnResource).toHaveBeenNthCalledWith(2, 'tables', { offset: 1, limit: 10000, search: 'x' });
     });
   });
 
@@ -1,4 +1,5 @@
 import {
+  AdHocVariableFilter,
   DataFrame,
   DataFrameView,
   DataQueryRequest,
@@ -12,12 +13,14 @@ import {
 } from '@grafana/data';
 import { DataSourceWithBackend, getTemplateSrv } from '@grafana/runtime';
 import { Observable } from 'rxjs';
-import { QuestDBConfig, QuestDBQuery, FullField, QueryType } from '../types';
+import { QuestDBConfig, QuestDBQuery, FullField, QueryType, SchemaPage } from '../types';
 import { AdHocFilter } from './adHocFilter';
 import { isString } from 'lodash';
 import { Table } from '../components/questdb-sql/utils';
 import { InformationSchemaColumn } from '../components/questdb-sql/types';
 
+const SCHEMA_PAGE_SIZE = 10000;
+
 export class Datasource extends DataSourceWithBackend<QuestDBQuery, QuestDBConfig> {
   // This enables default annotation support for 7.2+
   annotations = {};
@@ -56,22 +59,41 @@ export class Datasource extends DataSourceWithBackend<QuestDBQuery, QuestDBConfi
     return frame?.fields[1]?.values.toArray().map((text, i) => ({ text, value: ids.get(i) }));
   }
 
-  applyTemplateVariables(query: QuestDBQuery, scoped: ScopedVars): QuestDBQuery {
+  applyTemplateVariables(query: QuestDBQuery, scoped: ScopedVars, filters?: AdHocVariableFilter[]): QuestDBQuery {
     let rawQuery = query.rawSql || '';
-    // we want to skip applying ad hoc filters when we are getting values for ad hoc filters
+    // we want to skip applying ad hoc filters when we are getting values for ad hoc filters,
+    // the others are sent with the query and applied by the backend
     const templateSrv = getTemplateSrv();
+    let adhocFilters: AdHocVariableFilter[] = [];
     if (!this.skipAdHocFilter) {
-      const adHocFilters = (templateSrv as any)?.getAdhocFilters(this.name);
-      rawQuery = this.adHocFilter.apply(rawQuery, adHocFilters);
+      adhocFilters = this.adHocFilter.qualify(filters ?? (templateSrv as any)?.getAdhocFilters(this.name));
     }
     this.skipAdHocFilter = false;
     rawQuery = this.applyConditionalAll(rawQuery, getTemplateSrv().getVariables());
+    const templateVariables = this.templateVariables(rawQuery, scoped);
     return {
       ...query,
       rawSql: this.replace(rawQuery, scoped) || '',
+      ...(adhocFilters.length > 0 ? { adhocFilters } : {}),
+      ...(Object.keys(templateVariables).length > 0 ? { templateVariables } : {}),
     };
   }
 
+  // values of the variables used as $__var(name), they are bound to the query by the backend
+  templateVariables(rawQuery: string, scoped: ScopedVars): Record<string, string[]> {
+    const variables: Record<string, string[]> = {};
+    const re = /\$__var\(\s*(\w+)/g;
+    let match: RegExpExecArray | null;
+    while ((match = re.exec(rawQuery)) !== null) {
+      const name = match[1];
+      getTemplateSrv().replace(`\${${name}}`, scoped, (value: any) => {
+        variables[name] = (Array.isArray(value) ? value : [value]).map((v) => String(v));
+        return '';
+      });
+    }
+    return variables;
+  }
+
   applyConditionalAll(rawQuery: string, templateVars: TypedVariableModel[]): string {
     if (!rawQuery) {
       return rawQuery;
@@ -141,38 +163,39 @@ export class Datasource extends DataSourceWithBackend<QuestDBQuery, QuestDBConfi
     return value;
   }
 
-  async fetchTables(): Promise<Table[]> {
-    const rawSql = `select table_name, partitionBy, designatedTimestamp, walEnabled, dedup  from tables()`;
-    const frame = await this.runQuery({ rawSql });
-    if (frame.fields?.length === 0) {
-      return [];
-    }
-    const view = new DataFrameView(frame);
-    return view.map((item) => ({
-      tableName: item[0],
-      partitionBy: item[1],
-      designatedTimestamp: item[2] === null ? '' : item[2],
-      walEnabled: item[3],
-      dedup: item[4],
-    }));
+  async fetchTables(search?: string): Promise<Table[]> {
+    return this.fetchSchema<Table>('tables', search);
   }
 
   async fetchFields(table: string): Promise<FullField[]> {
-    const rawSql = `select "column", type, designated from table_columns(\'${table}\')`;
-    const frame = await this.runQuery({ rawSql });
-    if (frame.fields?.length === 0) {
-      return [];
-    }
-    const view = new DataFrameView(frame);
-    return view.map((item) => ({
-      name: item[0],
-      type: item[1],
-      label: item[0] + ' [' + item[1] + ']',
+    const columns = await this.fetchSchema<{ name: string; type: string; designated: boolean }>(
+      `tables/${encodeURIComponent(table)}/columns`
+    );
+    return columns.map((column) => ({
+      name: column.name,
+      type: column.type,
+      label: column.name + ' [' + column.type + ']',
       picklistValues: [],
-      designated: item[2],
+      designated: column.designated,
     }));
   }
 
+  // reads every page of a schema resource served by the backend, which caches the schema
+  private async fetchSchema<T>(path: string, search?: string): Promise<T[]> {
+    const items: T[] = [];
+    let total = Infinity;
+    while (items.length < total) {
+      const params = { offset: items.length, limit: SCHEMA_PAGE_SIZE, ...(search ? { search } : {}) };
+      const page: SchemaPage<T> = await this.getResource(path, params);
+      items.push(...page.items);
+      total = page.total;
+      if (page.items.length === 0) {
+        break;
+      }
+    }
+    return items;
+  }
+
   async fetchTableFields(): Promise<InformationSchemaColumn[]> {
     const rawSql = 'select table_name, ordinal_position, column_name, data_type from information_schema.columns';
     const frame = await this.runQuery({ rawSql });
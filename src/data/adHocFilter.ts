@@ -15,42 +15,25 @@ export class AdHocFilter {
     }
   }
 
-  apply(sql: string, adHocFilters: AdHocVariableFilter[]): string {
-    if (sql === '' || !adHocFilters || adHocFilters.length === 0) {
-      return sql;
-    }
-    const filter = adHocFilters[0];
-
-    if (filter.key?.includes('.')) {
-      this._targetTable = filter.key.split('.')[0];
-    }
-    if (this._targetTable === '' || !sql.match(new RegExp(`.*\\b${this._targetTable}\\b.*`, 'gi'))) {
-      return sql;
-    }
-
-    const filters = adHocFilters
-      .filter((filter: AdHocVariableFilter) => {
-        const valid = isValid(filter);
+  /**
+   * Returns the valid filters with their keys prefixed by the target table, so that the backend applies them to
+   * the queries of that table only.
+   */
+  qualify<T extends { key: string; operator: string; value: string }>(adHocFilters: T[] | undefined): T[] {
+    return (adHocFilters || [])
+      .filter((f) => {
+        const valid = isValid(f as AdHocVariableFilter);
         if (!valid) {
-          console.error('Invalid adhoc filter will be ignored:', filter);
+          console.error('Invalid adhoc filter will be ignored:', f);
         }
         return valid;
       })
-      .map((f, i) => {
-        const key = f.key.includes('.') ? f.key.split('.')[1] : f.key;
-        const value = isNaN(Number(f.value)) ? (['true', 'false'].includes(f.value?.toLowerCase()) ? f.value : `'${f.value}'`) : Number(f.value);
-        const condition = i !== adHocFilters.length - 1 ? (f.condition ? f.condition : 'AND') : '';
-        const operator = f.operator;
-        return ` ${key} ${operator} ${value} ${condition}`;
-      })
-      .join('');
-
-    if (filters === '') {
-      return sql;
-    }
-    // Semicolons are not required and cause problems when building the SQL
-    //sql = sql.replace(';', '');
-    return `SELECT * FROM (${sql}) WHERE ${filters}`;
+      .map((f) => {
+        if (f.key.includes('.') || this._targetTable === '' || this._targetTable === 'default') {
+          return f;
+        }
+        return { ...f, key: `${this._targetTable}.${f.key}` };
+      });
   }
 }
 
@@ -58,11 +41,12 @@ function isValid(filter: AdHocVariableFilter): boolean {
   return filter.key !== undefined && filter.operator !== undefined && filter.value !== undefined;
 }
 
-type AdHocVariableFilterOperator = '>' | '<' | '=' | '!=' | '~' | '!~';
+type AdHocVariableFilterOperator = '>' | '<' | '=' | '!=' | '~' | '=~' | '!~' | '=|' | '!=|';
 
 export type AdHocVariableFilter = {
   key: string;
   operator: AdHocVariableFilterOperator;
   value: string;
+  values?: string[];
   condition?: string;
 };
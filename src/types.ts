@@ -14,6 +14,16 @@ export enum PostgresTLSMethods {
   fileContent = 'file-content',
 }
 
+export enum QuestDBDriver {
+  pq = 'pq',
+  pgx = 'pgx',
+}
+
+export enum QuestDBTransport {
+  pgwire = 'pgwire',
+  http = 'http',
+}
+
 export interface QuestDBConfig extends DataSourceJsonData {
   username: string;
   server: string;
@@ -30,12 +40,77 @@ export interface QuestDBConfig extends DataSourceJsonData {
   maxIdleConnections?: number;
   maxConnectionLifetime?: number;
   timeInterval?: string;
+  driver?: QuestDBDriver;
+  transport?: QuestDBTransport;
+
+  disableKeepAlive?: boolean;
+  keepAliveIdle?: number;
+  keepAliveInterval?: number;
+  keepAliveCount?: number;
 
   tlsMode?: PostgresTLSModes;
   tlsConfigurationMethod?: PostgresTLSMethods;
+  tlsServerName?: string;
+  tlsMinVersion?: string;
 
+  tlsCACertFile?: string;
   tlsClientCertFile?: string;
   tlsClientKeyFile?: string;
+
+  hosts?: QuestDBHost[];
+  hostProbeInterval?: number;
+
+  enableSshTunnel?: boolean;
+  sshHost?: string;
+  sshPort?: number;
+  sshUser?: string;
+  sshKnownHosts?: string;
+
+  retryMaxAttempts?: number;
+  retryBackoff?: number;
+  retryMaxBackoff?: number;
+  retryJitter?: number;
+
+  cacheTTL?: number;
+  cacheMaxMemory?: number;
+
+  enableIncrementalRefresh?: boolean;
+  incrementalRefreshOverlap?: number;
+
+  streamPollInterval?: number;
+  streamMaxRows?: number;
+
+  schemaCacheTTL?: number;
+
+  customSettings?: CustomSetting[];
+  initStatements?: string[];
+
+  enableAlertingPool?: boolean;
+  alertingServer?: string;
+  alertingPort?: number;
+  alertingTimeout?: number;
+  alertingQueryTimeout?: number;
+  alertingMaxOpenConnections?: number;
+  alertingMaxIdleConnections?: number;
+  alertingMaxConnectionLifetime?: number;
+}
+
+export interface SchemaPage<T> {
+  items: T[];
+  total: number;
+  offset: number;
+  limit: number;
+}
+
+export interface CustomSetting {
+  setting: string;
+  value: string;
+}
+
+export interface QuestDBHost {
+  server: string;
+  port: number;
+  priority?: number;
 }
 
 export interface QuestDBSecureConfig {
@@ -43,6 +118,9 @@ export interface QuestDBSecureConfig {
   tlsCACert?: string; //sslRootCert
   tlsClientCert?: string; //sslCertFile
   tlsClientKey?: string; //sslKeyFile
+  sshPrivateKey?: string;
+  sshPassphrase?: string;
+  httpToken?: string;
 }
 
 export enum Format {
@@ -57,7 +135,24 @@ export enum QueryType {
   Builder = 'builder',
 }
 
-export interface QuestDBQueryBase extends DataQuery {}
+export interface QuestDBQueryBase extends DataQuery {
+  /** Streams the new rows over Grafana Live after the first response */
+  stream?: boolean;
+  /** Ad-hoc filters of the dashboard, applied to the query by the backend */
+  adhocFilters?: QueryAdHocFilter[];
+  /** Values of the variables used as $__var(name), bound to the query by the backend */
+  templateVariables?: Record<string, string[]>;
+}
+
+export interface QueryAdHocFilter {
+  /** column, or table.column */
+  key: string;
+  operator: string;
+  value: string;
+  /** values of the =| and !=| operators */
+  values?: string[];
+  condition?: string;
+}
 
 export interface QuestDBSQLQuery extends QuestDBQueryBase {
   queryType: QueryType.SQL;
@@ -85,6 +180,17 @@ export interface QuestDBBuilderQuery extends QuestDBQueryBase {
 
 export type QuestDBQuery = QuestDBSQLQuery | QuestDBBuilderQuery;
 
+/** Classified query failure, found in the custom metadata of the frame under `error` */
+export interface QueryErrorDetails {
+  kind: string;
+  code?: string;
+  message: string;
+  position?: number;
+  line?: number;
+  column?: number;
+  source: 'plugin' | 'downstream';
+}
+
 export enum BuilderMode {
   List = 'list',
   Aggregate = 'aggregate',
@@ -1,10 +1,10 @@
 import React from 'react';
-import { render, screen } from '@testing-library/react';
+import { fireEvent, render, screen } from '@testing-library/react';
 import { ConfigEditor } from './QuestDBConfigEditor';
 import { mockConfigEditorProps } from '../__mocks__/ConfigEditor';
 import { Components } from './../selectors';
 import '@testing-library/jest-dom';
-import { PostgresTLSModes } from '../types';
+import { PostgresTLSModes, QuestDBDriver, QuestDBTransport } from '../types';
 
 jest.mock('@grafana/runtime', () => {
   const original = jest.requireActual('@grafana/runtime');
@@ -98,4 +98,101 @@ describe('ConfigEditor', () => {
     expect(screen.getByPlaceholderText(Components.ConfigEditor.Timeout.placeholder)).toBeInTheDocument();
     expect(screen.getByText(Components.ConfigEditor.SecureSocksProxy.label)).toBeInTheDocument();
   });
+
+  it('with ssh tunnel', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps({ enableSshTunnel: true })} />);
+    expect(screen.getByPlaceholderText(Components.ConfigEditor.SshHost.placeholder)).toBeInTheDocument();
+    expect(screen.getByPlaceholderText(Components.ConfigEditor.SshUser.placeholder)).toBeInTheDocument();
+    expect(screen.getByPlaceholderText(Components.ConfigEditor.SshPrivateKey.placeholder)).toBeInTheDocument();
+    expect(screen.getByLabelText(Components.ConfigEditor.SshPassphrase.label)).toBeInTheDocument();
+    expect(screen.getByPlaceholderText(Components.ConfigEditor.SshKnownHosts.placeholder)).toBeInTheDocument();
+  });
+
+  it('without ssh tunnel', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps()} />);
+    expect(screen.getByText(Components.ConfigEditor.SshTunnel.label)).toBeInTheDocument();
+    expect(screen.queryByPlaceholderText(Components.ConfigEditor.SshHost.placeholder)).not.toBeInTheDocument();
+  });
+
+  it('with http transport', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps({ transport: QuestDBTransport.http })} />);
+    expect(screen.getByText('HTTP')).toBeInTheDocument();
+    expect(screen.getByLabelText(Components.ConfigEditor.HttpToken.label)).toBeInTheDocument();
+  });
+
+  it('with pgwire transport', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps()} />);
+    expect(screen.getByText('PGWire')).toBeInTheDocument();
+    expect(screen.queryByLabelText(Components.ConfigEditor.HttpToken.label)).not.toBeInTheDocument();
+  });
+
+  it('with pgx driver', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps({ driver: QuestDBDriver.pgx })} />);
+    expect(screen.getByText(Components.ConfigEditor.Driver.label)).toBeInTheDocument();
+    expect(screen.getByText('pgx')).toBeInTheDocument();
+  });
+
+  it('with session settings', async () => {
+    render(
+      <ConfigEditor
+        {...mockConfigEditorProps({
+          customSettings: [{ setting: 'application_name', value: 'grafana' }],
+          initStatements: ['SET search_path = public'],
+        })}
+      />
+    );
+    expect(screen.getByDisplayValue('application_name')).toBeInTheDocument();
+    expect(screen.getByDisplayValue('grafana')).toBeInTheDocument();
+    expect(screen.getByDisplayValue('SET search_path = public')).toBeInTheDocument();
+  });
+
+  it('adds a custom setting', async () => {
+    const props = mockConfigEditorProps();
+    render(<ConfigEditor {...props} />);
+    fireEvent.click(screen.getByText(Components.ConfigEditor.CustomSettings.AddLabel));
+    expect(props.onOptionsChange).toHaveBeenCalledWith(
+      expect.objectContaining({
+        jsonData: expect.objectContaining({ customSettings: [{ setting: '', value: '' }] }),
+      })
+    );
+  });
+
+  it('without session settings over http', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps({ transport: QuestDBTransport.http })} />);
+    expect(screen.queryByText(Components.ConfigEditor.InitStatements.label)).not.toBeInTheDocument();
+  });
+
+  it('with retry policy', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps({ retryMaxAttempts: 3, retryBackoff: 100 })} />);
+    expect(screen.getByPlaceholderText(Components.ConfigEditor.RetryMaxAttempts.placeholder)).toHaveValue(3);
+    expect(screen.getByPlaceholderText(Components.ConfigEditor.RetryBackoff.placeholder)).toHaveValue(100);
+  });
+
+  it('with query cache', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps({ cacheTTL: 30 })} />);
+    expect(screen.getByPlaceholderText(Components.ConfigEditor.CacheTTL.placeholder)).toHaveValue(30);
+    expect(screen.getByPlaceholderText(Components.ConfigEditor.CacheMaxMemory.placeholder)).toBeInTheDocument();
+  });
+
+  it('with incremental refresh', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps({ enableIncrementalRefresh: true })} />);
+    expect(screen.getByText(Components.ConfigEditor.IncrementalRefresh.label)).toBeInTheDocument();
+    expect(screen.getByLabelText(Components.ConfigEditor.IncrementalRefreshOverlap.label)).toBeInTheDocument();
+  });
+
+  it('without incremental refresh', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps()} />);
+    expect(screen.queryByLabelText(Components.ConfigEditor.IncrementalRefreshOverlap.label)).not.toBeInTheDocument();
+  });
+
+  it('with streaming', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps({ streamPollInterval: 500, streamMaxRows: 100 })} />);
+    expect(screen.getByLabelText(Components.ConfigEditor.StreamPollInterval.label)).toHaveValue(500);
+    expect(screen.getByLabelText(Components.ConfigEditor.StreamMaxRows.label)).toHaveValue(100);
+  });
+
+  it('with schema cache', async () => {
+    render(<ConfigEditor {...mockConfigEditorProps({ schemaCacheTTL: 60 })} />);
+    expect(screen.getByPlaceholderText(Components.ConfigEditor.SchemaCacheTTL.placeholder)).toHaveValue(60);
+  });
 });
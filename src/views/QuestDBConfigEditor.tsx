@@ -5,10 +5,17 @@ import {
   onUpdateDatasourceSecureJsonDataOption,
   SelectableValue,
 } from '@grafana/data';
-import { Field, Input, SecretInput, Select, Switch } from '@grafana/ui';
+import { Button, Field, Input, SecretInput, Select, Switch, TextArea } from '@grafana/ui';
 import { CertificationKey } from '../components/ui/CertificationKey';
 import { Components } from './../selectors';
-import { PostgresTLSModes, QuestDBConfig, QuestDBSecureConfig } from './../types';
+import {
+  CustomSetting,
+  PostgresTLSModes,
+  QuestDBConfig,
+  QuestDBDriver,
+  QuestDBSecureConfig,
+  QuestDBTransport,
+} from './../types';
 import { gte } from 'semver';
 import { ConfigSection, DataSourceDescription } from '@grafana/experimental';
 import { config } from '@grafana/runtime';
@@ -23,6 +30,7 @@ export const ConfigEditor: React.FC<Props> = (props) => {
   const hasTLSCACert = secureJsonFields && secureJsonFields.tlsCACert;
   const hasTLSClientCert = secureJsonFields && secureJsonFields.tlsClientCert;
   const hasTLSClientKey = secureJsonFields && secureJsonFields.tlsClientKey;
+  const hasSshPrivateKey = secureJsonFields && secureJsonFields.sshPrivateKey;
   const onPortChange = (port: string) => {
     onOptionsChange({
       ...options,
@@ -41,7 +49,68 @@ export const ConfigEditor: React.FC<Props> = (props) => {
       },
     });
   };
-  const onSwitchToggle = (key: keyof Pick<QuestDBConfig, 'validate' | 'enableSecureSocksProxy'>, value: boolean) => {
+  const onSshKnownHostsChange = (sshKnownHosts: string) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...options.jsonData,
+        sshKnownHosts,
+      },
+    });
+  };
+  const onTransportChange = (transport?: QuestDBTransport) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...options.jsonData,
+        transport,
+      },
+    });
+  };
+  const onDriverChange = (driver?: QuestDBDriver) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...options.jsonData,
+        driver,
+      },
+    });
+  };
+  const onCustomSettingsChange = (customSettings: CustomSetting[]) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...options.jsonData,
+        customSettings,
+      },
+    });
+  };
+  const onCustomSettingChange = (index: number, setting: CustomSetting) => {
+    const customSettings = [...(jsonData.customSettings || [])];
+    customSettings[index] = setting;
+    onCustomSettingsChange(customSettings);
+  };
+  const onInitStatementsChange = (initStatements: string[]) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...options.jsonData,
+        initStatements,
+      },
+    });
+  };
+  const onInitStatementChange = (index: number, statement: string) => {
+    const initStatements = [...(jsonData.initStatements || [])];
+    initStatements[index] = statement;
+    onInitStatementsChange(initStatements);
+  };
+  const onSwitchToggle = (
+    key: keyof Pick<
+      QuestDBConfig,
+      'validate' | 'enableSecureSocksProxy' | 'enableSshTunnel' | 'enableIncrementalRefresh'
+    >,
+    value: boolean
+  ) => {
     onOptionsChange({
       ...options,
       jsonData: {
@@ -90,7 +159,22 @@ export const ConfigEditor: React.FC<Props> = (props) => {
   const onUpdateNumberOption = (
     key: keyof Pick<
       QuestDBConfig,
-      'timeout' | 'queryTimeout' | 'maxConnectionLifetime' | 'maxIdleConnections' | 'maxOpenConnections'
+      | 'timeout'
+      | 'queryTimeout'
+      | 'maxConnectionLifetime'
+      | 'maxIdleConnections'
+      | 'maxOpenConnections'
+      | 'sshPort'
+      | 'retryMaxAttempts'
+      | 'retryBackoff'
+      | 'retryMaxBackoff'
+      | 'retryJitter'
+      | 'cacheTTL'
+      | 'cacheMaxMemory'
+      | 'incrementalRefreshOverlap'
+      | 'streamPollInterval'
+      | 'streamMaxRows'
+      | 'schemaCacheTTL'
     >,
     value: string
   ) => {
@@ -110,6 +194,16 @@ export const ConfigEditor: React.FC<Props> = (props) => {
     { value: PostgresTLSModes.verifyFull, label: 'verify-full' },
   ];
 
+  const drivers: Array<SelectableValue<QuestDBDriver>> = [
+    { value: QuestDBDriver.pq, label: 'lib/pq' },
+    { value: QuestDBDriver.pgx, label: 'pgx' },
+  ];
+
+  const transports: Array<SelectableValue<QuestDBTransport>> = [
+    { value: QuestDBTransport.pgwire, label: 'PGWire' },
+    { value: QuestDBTransport.http, label: 'HTTP' },
+  ];
+
   return (
     <>
       <DataSourceDescription
@@ -150,6 +244,28 @@ export const ConfigEditor: React.FC<Props> = (props) => {
             placeholder={Components.ConfigEditor.ServerPort.placeholder}
           />
         </Field>
+        <Field label={Components.ConfigEditor.Transport.label} description={Components.ConfigEditor.Transport.tooltip}>
+          <Select
+            id="transport"
+            width={40}
+            className="gf-form"
+            options={transports}
+            value={jsonData.transport || QuestDBTransport.pgwire}
+            onChange={(e) => onTransportChange(e.value)}
+          />
+        </Field>
+        {jsonData.transport !== QuestDBTransport.http && (
+          <Field label={Components.ConfigEditor.Driver.label} description={Components.ConfigEditor.Driver.tooltip}>
+            <Select
+              id="driver"
+              width={40}
+              className="gf-form"
+              options={drivers}
+              value={jsonData.driver || QuestDBDriver.pq}
+              onChange={(e) => onDriverChange(e.value)}
+            />
+          </Field>
+        )}
       </ConfigSection>
 
       <Divider />
@@ -178,6 +294,23 @@ export const ConfigEditor: React.FC<Props> = (props) => {
             onChange={onUpdateDatasourceSecureJsonDataOption(props, 'password')}
           />
         </Field>
+        {jsonData.transport === QuestDBTransport.http && (
+          <Field
+            label={Components.ConfigEditor.HttpToken.label}
+            description={Components.ConfigEditor.HttpToken.tooltip}
+          >
+            <SecretInput
+              name="httpToken"
+              width={40}
+              label={Components.ConfigEditor.HttpToken.label}
+              aria-label={Components.ConfigEditor.HttpToken.label}
+              value={secureJsonData.httpToken || ''}
+              isConfigured={(secureJsonFields && secureJsonFields.httpToken) as boolean}
+              onReset={() => onResetClickFactory('httpToken')}
+              onChange={onUpdateDatasourceSecureJsonDataOption(props, 'httpToken')}
+            />
+          </Field>
+        )}
       </ConfigSection>
 
       <Divider />
@@ -277,6 +410,193 @@ export const ConfigEditor: React.FC<Props> = (props) => {
         </Field>
       </ConfigSection>
 
+      <Divider />
+      <ConfigSection title="Retries">
+        <Field
+          label={Components.ConfigEditor.RetryMaxAttempts.label}
+          description={Components.ConfigEditor.RetryMaxAttempts.tooltip}
+        >
+          <Input
+            name="retryMaxAttempts"
+            width={40}
+            value={jsonData.retryMaxAttempts || ''}
+            onChange={(e) => onUpdateNumberOption('retryMaxAttempts', e.currentTarget.value)}
+            label={Components.ConfigEditor.RetryMaxAttempts.label}
+            aria-label={Components.ConfigEditor.RetryMaxAttempts.label}
+            placeholder={Components.ConfigEditor.RetryMaxAttempts.placeholder}
+            type="number"
+          />
+        </Field>
+
+        <Field
+          label={Components.ConfigEditor.RetryBackoff.label}
+          description={Components.ConfigEditor.RetryBackoff.tooltip}
+        >
+          <Input
+            name="retryBackoff"
+            width={40}
+            value={jsonData.retryBackoff || ''}
+            onChange={(e) => onUpdateNumberOption('retryBackoff', e.currentTarget.value)}
+            label={Components.ConfigEditor.RetryBackoff.label}
+            aria-label={Components.ConfigEditor.RetryBackoff.label}
+            placeholder={Components.ConfigEditor.RetryBackoff.placeholder}
+            type="number"
+          />
+        </Field>
+
+        <Field
+          label={Components.ConfigEditor.RetryMaxBackoff.label}
+          description={Components.ConfigEditor.RetryMaxBackoff.tooltip}
+        >
+          <Input
+            name="retryMaxBackoff"
+            width={40}
+            value={jsonData.retryMaxBackoff || ''}
+            onChange={(e) => onUpdateNumberOption('retryMaxBackoff', e.currentTarget.value)}
+            label={Components.ConfigEditor.RetryMaxBackoff.label}
+            aria-label={Components.ConfigEditor.RetryMaxBackoff.label}
+            placeholder={Components.ConfigEditor.RetryMaxBackoff.placeholder}
+            type="number"
+          />
+        </Field>
+
+        <Field
+          label={Components.ConfigEditor.RetryJitter.label}
+          description={Components.ConfigEditor.RetryJitter.tooltip}
+        >
+          <Input
+            name="retryJitter"
+            width={40}
+            value={jsonData.retryJitter || ''}
+            onChange={(e) => onUpdateNumberOption('retryJitter', e.currentTarget.value)}
+            label={Components.ConfigEditor.RetryJitter.label}
+            aria-label={Components.ConfigEditor.RetryJitter.label}
+            placeholder={Components.ConfigEditor.RetryJitter.placeholder}
+            type="number"
+          />
+        </Field>
+      </ConfigSection>
+
+      <Divider />
+      <ConfigSection title="Query cache">
+        <Field
+          label={Components.ConfigEditor.CacheTTL.label}
+          description={Components.ConfigEditor.CacheTTL.tooltip}
+        >
+          <Input
+            name="cacheTTL"
+            width={40}
+            value={jsonData.cacheTTL || ''}
+            onChange={(e) => onUpdateNumberOption('cacheTTL', e.currentTarget.value)}
+            label={Components.ConfigEditor.CacheTTL.label}
+            aria-label={Components.ConfigEditor.CacheTTL.label}
+            placeholder={Components.ConfigEditor.CacheTTL.placeholder}
+            type="number"
+          />
+        </Field>
+
+        <Field
+          label={Components.ConfigEditor.CacheMaxMemory.label}
+          description={Components.ConfigEditor.CacheMaxMemory.tooltip}
+        >
+          <Input
+            name="cacheMaxMemory"
+            width={40}
+            value={jsonData.cacheMaxMemory || ''}
+            onChange={(e) => onUpdateNumberOption('cacheMaxMemory', e.currentTarget.value)}
+            label={Components.ConfigEditor.CacheMaxMemory.label}
+            aria-label={Components.ConfigEditor.CacheMaxMemory.label}
+            placeholder={Components.ConfigEditor.CacheMaxMemory.placeholder}
+            type="number"
+          />
+        </Field>
+      </ConfigSection>
+
+      <Divider />
+      <ConfigSection title="Incremental refresh">
+        <Field
+          label={Components.ConfigEditor.IncrementalRefresh.label}
+          description={Components.ConfigEditor.IncrementalRefresh.tooltip}
+        >
+          <Switch
+            className="gf-form"
+            value={jsonData.enableIncrementalRefresh || false}
+            onChange={(e) => onSwitchToggle('enableIncrementalRefresh', e.currentTarget.checked)}
+          />
+        </Field>
+        {jsonData.enableIncrementalRefresh && (
+          <Field
+            label={Components.ConfigEditor.IncrementalRefreshOverlap.label}
+            description={Components.ConfigEditor.IncrementalRefreshOverlap.tooltip}
+          >
+            <Input
+              name="incrementalRefreshOverlap"
+              width={40}
+              value={jsonData.incrementalRefreshOverlap || ''}
+              onChange={(e) => onUpdateNumberOption('incrementalRefreshOverlap', e.currentTarget.value)}
+              label={Components.ConfigEditor.IncrementalRefreshOverlap.label}
+              aria-label={Components.ConfigEditor.IncrementalRefreshOverlap.label}
+              placeholder={Components.ConfigEditor.IncrementalRefreshOverlap.placeholder}
+              type="number"
+            />
+          </Field>
+        )}
+      </ConfigSection>
+
+      <Divider />
+      <ConfigSection title="Streaming">
+        <Field
+          label={Components.ConfigEditor.StreamPollInterval.label}
+          description={Components.ConfigEditor.StreamPollInterval.tooltip}
+        >
+          <Input
+            name="streamPollInterval"
+            width={40}
+            value={jsonData.streamPollInterval || ''}
+            onChange={(e) => onUpdateNumberOption('streamPollInterval', e.currentTarget.value)}
+            label={Components.ConfigEditor.StreamPollInterval.label}
+            aria-label={Components.ConfigEditor.StreamPollInterval.label}
+            placeholder={Components.ConfigEditor.StreamPollInterval.placeholder}
+            type="number"
+          />
+        </Field>
+
+        <Field
+          label={Components.ConfigEditor.StreamMaxRows.label}
+          description={Components.ConfigEditor.StreamMaxRows.tooltip}
+        >
+          <Input
+            name="streamMaxRows"
+            width={40}
+            value={jsonData.streamMaxRows || ''}
+            onChange={(e) => onUpdateNumberOption('streamMaxRows', e.currentTarget.value)}
+            label={Components.ConfigEditor.StreamMaxRows.label}
+            aria-label={Components.ConfigEditor.StreamMaxRows.label}
+            placeholder={Components.ConfigEditor.StreamMaxRows.placeholder}
+            type="number"
+          />
+        </Field>
+      </ConfigSection>
+
+      <Divider />
+      <ConfigSection title="Schema">
+        <Field
+          label={Components.ConfigEditor.SchemaCacheTTL.label}
+          description={Components.ConfigEditor.SchemaCacheTTL.tooltip}
+        >
+          <Input
+            name="schemaCacheTTL"
+            width={40}
+            value={jsonData.schemaCacheTTL || ''}
+            onChange={(e) => onUpdateNumberOption('schemaCacheTTL', e.currentTarget.value)}
+            label={Components.ConfigEditor.SchemaCacheTTL.label}
+            aria-label={Components.ConfigEditor.SchemaCacheTTL.label}
+            placeholder={Components.ConfigEditor.SchemaCacheTTL.placeholder}
+            type="number"
+          />
+        </Field>
+      </ConfigSection>
+
       {config.secureSocksDSProxyEnabled && gte(config.buildInfo.version, '10.0.0') && (
         <>
           <Divider />
@@ -296,6 +616,188 @@ export const ConfigEditor: React.FC<Props> = (props) => {
         </>
       )}
 
+      <Divider />
+      <ConfigSection title="SSH tunnel">
+        <Field label={Components.ConfigEditor.SshTunnel.label} description={Components.ConfigEditor.SshTunnel.tooltip}>
+          <Switch
+            className="gf-form"
+            value={jsonData.enableSshTunnel || false}
+            onChange={(e) => onSwitchToggle('enableSshTunnel', e.currentTarget.checked)}
+          />
+        </Field>
+
+        {jsonData.enableSshTunnel && (
+          <>
+            <Field
+              required
+              label={Components.ConfigEditor.SshHost.label}
+              description={Components.ConfigEditor.SshHost.tooltip}
+            >
+              <Input
+                name="sshHost"
+                width={40}
+                value={jsonData.sshHost || ''}
+                onChange={onUpdateDatasourceJsonDataOption(props, 'sshHost')}
+                label={Components.ConfigEditor.SshHost.label}
+                aria-label={Components.ConfigEditor.SshHost.label}
+                placeholder={Components.ConfigEditor.SshHost.placeholder}
+              />
+            </Field>
+            <Field label={Components.ConfigEditor.SshPort.label} description={Components.ConfigEditor.SshPort.tooltip}>
+              <Input
+                name="sshPort"
+                width={40}
+                type="number"
+                value={jsonData.sshPort || ''}
+                onChange={(e) => onUpdateNumberOption('sshPort', e.currentTarget.value)}
+                label={Components.ConfigEditor.SshPort.label}
+                aria-label={Components.ConfigEditor.SshPort.label}
+                placeholder={Components.ConfigEditor.SshPort.placeholder}
+              />
+            </Field>
+            <Field
+              required
+              label={Components.ConfigEditor.SshUser.label}
+              description={Components.ConfigEditor.SshUser.tooltip}
+            >
+              <Input
+                name="sshUser"
+                width={40}
+                value={jsonData.sshUser || ''}
+                onChange={onUpdateDatasourceJsonDataOption(props, 'sshUser')}
+                label={Components.ConfigEditor.SshUser.label}
+                aria-label={Components.ConfigEditor.SshUser.label}
+                placeholder={Components.ConfigEditor.SshUser.placeholder}
+              />
+            </Field>
+            <CertificationKey
+              hasCert={!!hasSshPrivateKey}
+              onChange={(e) => onCertificateChangeFactory('sshPrivateKey', e.currentTarget.value)}
+              placeholder={Components.ConfigEditor.SshPrivateKey.placeholder}
+              label={Components.ConfigEditor.SshPrivateKey.label}
+              tooltip={Components.ConfigEditor.SshPrivateKey.tooltip}
+              onClick={() => onResetClickFactory('sshPrivateKey')}
+            />
+            <Field
+              label={Components.ConfigEditor.SshPassphrase.label}
+              description={Components.ConfigEditor.SshPassphrase.tooltip}
+            >
+              <SecretInput
+                name="sshPassphrase"
+                width={40}
+                label={Components.ConfigEditor.SshPassphrase.label}
+                aria-label={Components.ConfigEditor.SshPassphrase.label}
+                value={secureJsonData.sshPassphrase || ''}
+                isConfigured={(secureJsonFields && secureJsonFields.sshPassphrase) as boolean}
+                onReset={() => onResetClickFactory('sshPassphrase')}
+                onChange={onUpdateDatasourceSecureJsonDataOption(props, 'sshPassphrase')}
+              />
+            </Field>
+            <Field
+              required
+              label={Components.ConfigEditor.SshKnownHosts.label}
+              description={Components.ConfigEditor.SshKnownHosts.tooltip}
+            >
+              <TextArea
+                name="sshKnownHosts"
+                rows={4}
+                value={jsonData.sshKnownHosts || ''}
+                onChange={(e) => onSshKnownHostsChange(e.currentTarget.value)}
+                aria-label={Components.ConfigEditor.SshKnownHosts.label}
+                placeholder={Components.ConfigEditor.SshKnownHosts.placeholder}
+              />
+            </Field>
+          </>
+        )}
+      </ConfigSection>
+
+      {jsonData.transport !== QuestDBTransport.http && (
+        <>
+          <Divider />
+          <ConfigSection title="Session">
+            <Field
+              label={Components.ConfigEditor.CustomSettings.label}
+              description={Components.ConfigEditor.CustomSettings.tooltip}
+            >
+              <>
+                {(jsonData.customSettings || []).map((setting, index) => (
+                  <div className="gf-form" key={index}>
+                    <Input
+                      width={30}
+                      value={setting.setting}
+                      onChange={(e) => onCustomSettingChange(index, { ...setting, setting: e.currentTarget.value })}
+                      aria-label={Components.ConfigEditor.CustomSettings.settingPlaceholder}
+                      placeholder={Components.ConfigEditor.CustomSettings.settingPlaceholder}
+                    />
+                    <Input
+                      width={30}
+                      value={setting.value}
+                      onChange={(e) => onCustomSettingChange(index, { ...setting, value: e.currentTarget.value })}
+                      aria-label={Components.ConfigEditor.CustomSettings.valuePlaceholder}
+                      placeholder={Components.ConfigEditor.CustomSettings.valuePlaceholder}
+                    />
+                    <Button
+                      variant="destructive"
+                      size="sm"
+                      icon="trash-alt"
+                      aria-label={Components.ConfigEditor.CustomSettings.RemoveLabel}
+                      onClick={() =>
+                        onCustomSettingsChange((jsonData.customSettings || []).filter((_, i) => i !== index))
+                      }
+                    />
+                  </div>
+                ))}
+                <Button
+                  icon="plus-circle"
+                  variant="secondary"
+                  size="sm"
+                  onClick={() =>
+                    onCustomSettingsChange([...(jsonData.customSettings || []), { setting: '', value: '' }])
+                  }
+                >
+                  {Components.ConfigEditor.CustomSettings.AddLabel}
+                </Button>
+              </>
+            </Field>
+            <Field
+              label={Components.ConfigEditor.InitStatements.label}
+              description={Components.ConfigEditor.InitStatements.tooltip}
+            >
+              <>
+                {(jsonData.initStatements || []).map((statement, index) => (
+                  <div className="gf-form" key={index}>
+                    <Input
+                      width={60}
+                      value={statement}
+                      onChange={(e) => onInitStatementChange(index, e.currentTarget.value)}
+                      aria-label={Components.ConfigEditor.InitStatements.label}
+                      placeholder={Components.ConfigEditor.InitStatements.placeholder}
+                    />
+                    <Button
+                      variant="destructive"
+                      size="sm"
+                      icon="trash-alt"
+                      aria-label={Components.ConfigEditor.InitStatements.RemoveLabel}
+                      onClick={() =>
+                        onInitStatementsChange((jsonData.initStatements || []).filter((_, i) => i !== index))
+                      }
+                    />
+                  </div>
+                ))}
+                <Button
+                  icon="plus-circle"
+                  variant="secondary"
+                  size="sm"
+                  onClick={() => onInitStatementsChange([...(jsonData.initStatements || []), ''])}
+                >
+                  {Components.ConfigEditor.InitStatements.AddLabel}
+                </Button>
+              </>
+            </Field>
+          </ConfigSection>
+        </>
+      )}
+
       <Divider />
       <ConfigSection title="TLS / SSL Settings">
         <Field label={Components.ConfigEditor.TlsMode.label} description={Components.ConfigEditor.TlsMode.tooltip}>